@@ -0,0 +1,122 @@
+package apperror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind classifies an error by how the client should react to it
+type Kind string
+
+const (
+	// KindInvalid means the request itself is wrong and must not be retried unchanged
+	KindInvalid Kind = "invalid"
+	// KindUnauthorized means the request lacks valid credentials
+	KindUnauthorized Kind = "unauthorized"
+	// KindNotFound means the requested resource does not exist
+	KindNotFound Kind = "not-found"
+	// KindConflict means the request clashes with the current state, such as an operation already in progress
+	KindConflict Kind = "conflict"
+	// KindTimeout means a dependency did not answer in time; retrying may succeed
+	KindTimeout Kind = "timeout"
+	// KindUnavailable means a dependency is down or refused the request; retrying later may succeed
+	KindUnavailable Kind = "unavailable"
+	// KindInternal is anything else
+	KindInternal Kind = "internal"
+)
+
+// Status returns the HTTP status code for errors of this kind
+func (k Kind) Status() int {
+	switch k {
+	case KindInvalid:
+		return http.StatusBadRequest
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindConflict:
+		return http.StatusConflict
+	case KindTimeout:
+		return http.StatusGatewayTimeout
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// InvalidParam names one rejected request parameter and why it was rejected
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Error is an error with a kind, a message safe to show to clients and an optional cause
+// that is only logged
+type Error struct {
+	Kind    Kind
+	Message string
+	Params  []InvalidParam
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NotFound reports a missing resource
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+// Invalid reports a bad request, listing the offending parameters
+func Invalid(message string, params ...InvalidParam) *Error {
+	return &Error{Kind: KindInvalid, Message: message, Params: params}
+}
+
+// Unauthorized reports missing or wrong credentials
+func Unauthorized(message string) *Error {
+	return &Error{Kind: KindUnauthorized, Message: message}
+}
+
+// Conflict reports a request that clashes with the current state
+func Conflict(message string) *Error {
+	return &Error{Kind: KindConflict, Message: message}
+}
+
+// Timeout reports a dependency that did not answer in time
+func Timeout(message string, err error) *Error {
+	return &Error{Kind: KindTimeout, Message: message, Err: err}
+}
+
+// Unavailable reports a dependency that is down or refused the request
+func Unavailable(message string, err error) *Error {
+	return &Error{Kind: KindUnavailable, Message: message, Err: err}
+}
+
+// Internal reports an unexpected failure
+func Internal(message string, err error) *Error {
+	return &Error{Kind: KindInternal, Message: message, Err: err}
+}
+
+// From returns err as an *Error. Errors that are not typed yet are classified as a
+// timeout when a deadline expired and as internal otherwise, using fallback as the message.
+func From(err error, fallback string) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Timeout("the request timed out", err)
+	}
+	return Internal(fallback, err)
+}
@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned by Get when the key is not cached
+var ErrMiss = errors.New("cache miss")
+
+// Cache is a key/value store with per-entry expiration
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// GetWithTTL also returns the remaining time to live, or zero if the key never expires
+	GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	// Incr atomically increments an integer counter, creating it at zero if missing
+	Incr(ctx context.Context, key string) (int64, error)
+	// SetWithTags stores a value and records its key under each tag
+	SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	// InvalidateTags deletes every key recorded under the given tags, then the tags themselves
+	InvalidateTags(ctx context.Context, tags ...string) error
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"query-service/metrics"
+	"time"
+)
+
+// InstrumentedCache counts lookups of the wrapped cache per key prefix and result
+type InstrumentedCache struct {
+	Cache
+}
+
+// NewInstrumentedCache wraps c so every Get and GetWithTTL is recorded in metrics.CacheRequests
+func NewInstrumentedCache(c Cache) *InstrumentedCache {
+	return &InstrumentedCache{Cache: c}
+}
+
+func (c *InstrumentedCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.Cache.Get(ctx, key)
+	observe(key, err)
+	return value, err
+}
+
+func (c *InstrumentedCache) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	value, ttl, err := c.Cache.GetWithTTL(ctx, key)
+	observe(key, err)
+	return value, ttl, err
+}
+
+func observe(key string, err error) {
+	result := metrics.CacheHit
+	switch {
+	case errors.Is(err, ErrMiss):
+		result = metrics.CacheMiss
+	case err != nil:
+		result = metrics.CacheError
+	}
+	metrics.CacheRequests.WithLabelValues(KeyPrefix(key), result).Inc()
+}
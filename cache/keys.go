@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cache keys are built here so reads and invalidations always agree on naming.
+//
+// Entries are also tagged with the entities they embed (see ProductTag and friends), so
+// changing one entity can drop every cached entry that contains it with InvalidateTags.
+//
+// List pages are version-stamped: every page key embeds the current value of a
+// per-list version counter, and invalidating the list bumps the counter so all
+// page/size, sort and filter variants are orphaned at once and expire on their own TTL.
+//
+// Suggestions are neither tagged nor versioned: they embed too many products to track and
+// are only cached for a short TTL instead.
+//
+// Tags recorded on each entry:
+//
+//	product:<id>                          tag:product:<id>
+//	order:<id>                            tag:order:<id>
+//	customer:<id>                         tag:customer:<id>, tag:order:<orderId> per order history entry
+//	products:category:<id> pages          tag:product:<productId> per product on the page
+//	customer:<id>:orders pages            tag:order:<orderId> per order on the page
+//
+// Invalidation matrix (event -> what it must clear):
+//
+//	ProductCreated      invalidate tag:product:<id>, delete inventory:<id>, bump products:category:<categoryId> and its parent's
+//	ProductUpdated      invalidate tag:product:<id>, delete inventory:<id>, bump products:category:<categoryId> and its parent's for old and new category
+//	InventoryChanged    invalidate tag:product:<id>, bump products:category:<categoryId> and its parent's, then set inventory:<id>
+//	OrderCreated        invalidate tag:customer:<customerId>, bump customer:<customerId>:orders
+//	OrderStatusChanged  invalidate tag:order:<id>
+//	reindex batch       invalidate tag:product:<id> and delete inventory:<id> per product, bump products:category:<categoryId> and its parent's
+
+// ProductKey caches a single product
+func ProductKey(productID string) string {
+	return "product:" + productID
+}
+
+// InventoryKey caches the current inventory of a product
+func InventoryKey(productID string) string {
+	return "inventory:" + productID
+}
+
+// OrderKey caches a single order
+func OrderKey(orderID string) string {
+	return "order:" + orderID
+}
+
+// CustomerKey caches a single customer, including its order history
+func CustomerKey(customerID string) string {
+	return "customer:" + customerID
+}
+
+// ProductTag groups every entry that embeds a product
+func ProductTag(productID string) string {
+	return "tag:product:" + productID
+}
+
+// OrderTag groups every entry that embeds an order
+func OrderTag(orderID string) string {
+	return "tag:order:" + orderID
+}
+
+// CustomerTag groups every entry that embeds a customer
+func CustomerTag(customerID string) string {
+	return "tag:customer:" + customerID
+}
+
+// CategoryListKey is the version counter for a category's product pages
+func CategoryListKey(categoryID string) string {
+	return "products:category:" + categoryID
+}
+
+// CustomerOrdersListKey is the version counter for a customer's order pages
+func CustomerOrdersListKey(customerID string) string {
+	return "customer:" + customerID + ":orders"
+}
+
+// SuggestKey caches the suggestions for normalized search text. The text goes last since it
+// may contain colons.
+func SuggestKey(text string, size int) string {
+	return fmt.Sprintf("suggest:size:%d:q:%s", size, text)
+}
+
+// PageKey caches one page of a version-stamped list. variant distinguishes differently
+// sorted or filtered views of the same list and must not contain colons.
+func PageKey(listKey string, version int64, variant string, page, size int) string {
+	return fmt.Sprintf("%s:v%d:%spage:%d:size:%d", listKey, version, variantSegment(variant), page, size)
+}
+
+// CursorPageKey caches the page of a version-stamped list that a cursor token points at
+func CursorPageKey(listKey string, version int64, variant, cursor string, size int) string {
+	return fmt.Sprintf("%s:v%d:%scursor:%s:size:%d", listKey, version, variantSegment(variant), cursor, size)
+}
+
+func variantSegment(variant string) string {
+	if variant == "" {
+		return ""
+	}
+	return "q:" + variant + ":"
+}
+
+// KeyPrefix reduces a key to the family it belongs to, e.g. "product" or
+// "products:category:page", so it can be used as a metric label
+func KeyPrefix(key string) string {
+	parts := strings.Split(key, ":")
+	switch {
+	case parts[0] == "tag":
+		return "tag"
+	case len(parts) >= 3 && parts[0] == "products" && parts[1] == "category":
+		if len(parts) > 3 {
+			return "products:category:page"
+		}
+		return "products:category:version"
+	case len(parts) >= 3 && parts[0] == "customer" && parts[2] == "orders":
+		if len(parts) > 3 {
+			return "customer:orders:page"
+		}
+		return "customer:orders:version"
+	default:
+		return parts[0]
+	}
+}
+
+// ListVersion returns the current version of a list, or zero if it has never been invalidated
+func ListVersion(ctx context.Context, c Cache, listKey string) (int64, error) {
+	value, err := c.Get(ctx, listKey)
+	if errors.Is(err, ErrMiss) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
+
+// InvalidateList bumps a list's version so every cached page of it is skipped
+func InvalidateList(ctx context.Context, c Cache, listKey string) error {
+	_, err := c.Incr(ctx, listKey)
+	return err
+}
@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"math/rand"
+	"query-service/logging"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+// Source reports where a read-through value was served from
+type Source string
+
+const (
+	SourceCache    Source = "cache"
+	SourceDatabase Source = "database"
+)
+
+// refreshTimeout bounds background early refreshes, which outlive the request that triggered them
+const refreshTimeout = 5 * time.Second
+
+// loadTimeout bounds a load shared by concurrent misses, which runs detached from the
+// request that started it
+const loadTimeout = 5 * time.Second
+
+// KeyFunc builds the cache key for an entity ID
+type KeyFunc func(id string) string
+
+// LoaderFunc loads an entity from the backing store on a cache miss
+type LoaderFunc[T any] func(ctx context.Context, id string) (T, error)
+
+// Stats counts how a ReadThrough has served its reads
+type Stats struct {
+	Hits           int64 `json:"hits"`
+	Misses         int64 `json:"misses"`
+	Loads          int64 `json:"loads"`
+	Collapsed      int64 `json:"collapsed"`
+	EarlyRefreshes int64 `json:"earlyRefreshes"`
+}
+
+// ReadThrough serves entities from the cache and falls back to a loader on a miss,
+// writing loaded values back with a fixed TTL. Concurrent misses for the same key
+// share a single loader call.
+type ReadThrough[T any] struct {
+	cache Cache
+	key   KeyFunc
+	load  LoaderFunc[T]
+	ttl   time.Duration
+	tags  func(T) []string
+	group singleflight.Group
+
+	// XFetch early expiration; disabled when beta is zero
+	beta  float64
+	delta atomic.Int64 // moving average of loader duration in nanoseconds
+
+	hits           atomic.Int64
+	misses         atomic.Int64
+	loads          atomic.Int64
+	collapsed      atomic.Int64
+	earlyRefreshes atomic.Int64
+}
+
+// NewReadThrough creates a read-through cache for one entity type.
+// key and load may be nil when the cache is only used through Fetch.
+func NewReadThrough[T any](cache Cache, key KeyFunc, load LoaderFunc[T], ttl time.Duration) *ReadThrough[T] {
+	return &ReadThrough[T]{
+		cache: cache,
+		key:   key,
+		load:  load,
+		ttl:   ttl,
+	}
+}
+
+// WithEarlyRefresh enables probabilistic early expiration (XFetch). Hits are refreshed in the
+// background with a probability that rises as the entry nears expiry; larger beta refreshes earlier.
+func (r *ReadThrough[T]) WithEarlyRefresh(beta float64) *ReadThrough[T] {
+	r.beta = beta
+	return r
+}
+
+// WithTags records each stored value under the tags returned by tags, so it can be dropped
+// with Cache.InvalidateTags when anything it embeds changes
+func (r *ReadThrough[T]) WithTags(tags func(T) []string) *ReadThrough[T] {
+	r.tags = tags
+	return r
+}
+
+// Stats returns a snapshot of the read counters
+func (r *ReadThrough[T]) Stats() Stats {
+	return Stats{
+		Hits:           r.hits.Load(),
+		Misses:         r.misses.Load(),
+		Loads:          r.loads.Load(),
+		Collapsed:      r.collapsed.Load(),
+		EarlyRefreshes: r.earlyRefreshes.Load(),
+	}
+}
+
+// Get returns the entity for id and where it came from, using the configured key builder and loader
+func (r *ReadThrough[T]) Get(ctx context.Context, id string) (T, Source, error) {
+	return r.Fetch(ctx, r.key(id), func(ctx context.Context) (T, error) {
+		return r.load(ctx, id)
+	})
+}
+
+// Fetch returns the value cached under key, calling load on a miss. Loader errors are returned
+// unchanged; cache failures are logged and the value is served from the loader instead.
+func (r *ReadThrough[T]) Fetch(ctx context.Context, key string, load func(context.Context) (T, error)) (T, Source, error) {
+	// Attempt to retrieve the value from the cache
+	cached, remaining, err := r.cache.GetWithTTL(ctx, key)
+	cacheUp := true
+	switch {
+	case err == nil:
+		var value T
+		decodeErr := json.Unmarshal(cached, &value)
+		if decodeErr == nil {
+			r.hits.Add(1)
+			if r.shouldRefreshEarly(remaining) {
+				r.refreshInBackground(ctx, key, load)
+			}
+			return value, SourceCache, nil
+		}
+		// Drop the corrupt entry so the next read repopulates it
+		logger := logging.FromContext(ctx).With(slog.String(logging.KeyCacheKey, key))
+		logger.Warn("failed to decode cached value", logging.Err(decodeErr))
+		if err := r.cache.Del(ctx, key); err != nil {
+			logger.Warn("failed to delete corrupt cache entry", logging.Err(err))
+		}
+	case errors.Is(err, ErrMiss), errors.Is(err, redis.Nil):
+		// Plain miss, fall through to the loader
+	default:
+		// The cache itself is unavailable; serve from the loader without writing back
+		logging.FromContext(ctx).Warn("cache unavailable", slog.String(logging.KeyCacheKey, key), logging.Err(err))
+		cacheUp = false
+	}
+	r.misses.Add(1)
+
+	// On a miss, load from the backing store, sharing the call with concurrent misses. The
+	// load is detached from this request so a caller that gives up doesn't fail the others;
+	// each caller only waits as long as its own context allows.
+	executed := false
+	results := r.group.DoChan(key, func() (interface{}, error) {
+		executed = true
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		return r.fetch(loadCtx, key, load, cacheUp)()
+	})
+
+	var value T
+	select {
+	case result := <-results:
+		if !executed {
+			r.collapsed.Add(1)
+		}
+		value, _ = result.Val.(T)
+		return value, SourceDatabase, result.Err
+	case <-ctx.Done():
+		return value, SourceDatabase, ctx.Err()
+	}
+}
+
+// fetch returns a singleflight function that calls load and optionally writes the result back
+func (r *ReadThrough[T]) fetch(ctx context.Context, key string, load func(context.Context) (T, error), writeBack bool) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		r.loads.Add(1)
+		start := time.Now()
+		value, err := load(ctx)
+		r.observe(time.Since(start))
+		if err != nil {
+			return value, err
+		}
+
+		if writeBack {
+			r.store(ctx, key, value)
+		}
+		return value, nil
+	}
+}
+
+// shouldRefreshEarly applies the XFetch test: refresh when delta*beta*-ln(rand) reaches the remaining TTL
+func (r *ReadThrough[T]) shouldRefreshEarly(remaining time.Duration) bool {
+	if r.beta <= 0 || remaining <= 0 {
+		return false
+	}
+	delta := float64(r.delta.Load())
+	if delta == 0 {
+		return false
+	}
+	gap := -delta * r.beta * math.Log(1-rand.Float64())
+	return gap >= float64(remaining)
+}
+
+// refreshInBackground reloads key without blocking the caller; concurrent refreshes share one load
+func (r *ReadThrough[T]) refreshInBackground(ctx context.Context, key string, load func(context.Context) (T, error)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+	fetch := r.fetch(ctx, key, load, true)
+
+	go func() {
+		defer cancel()
+
+		executed := false
+		result := <-r.group.DoChan(key, func() (interface{}, error) {
+			executed = true
+			return fetch()
+		})
+		if !executed {
+			return
+		}
+
+		r.earlyRefreshes.Add(1)
+		if result.Err != nil {
+			logging.FromContext(ctx).Warn("early refresh failed", slog.String(logging.KeyCacheKey, key), logging.Err(result.Err))
+		}
+	}()
+}
+
+// observe folds a loader duration into the moving average used by XFetch
+func (r *ReadThrough[T]) observe(d time.Duration) {
+	for {
+		old := r.delta.Load()
+		next := int64(d)
+		if old != 0 {
+			next = (old*7 + int64(d)) / 8
+		}
+		if r.delta.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// store writes a loaded value back to the cache, logging failures
+func (r *ReadThrough[T]) store(ctx context.Context, key string, value T) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to encode value for cache", slog.String(logging.KeyCacheKey, key), logging.Err(err))
+		return
+	}
+	var tags []string
+	if r.tags != nil {
+		tags = r.tags(value)
+	}
+	if err := r.cache.SetWithTags(ctx, key, encoded, r.ttl, tags...); err != nil {
+		logging.FromContext(ctx).Warn("failed to write cache", slog.String(logging.KeyCacheKey, key), logging.Err(err))
+	}
+}
@@ -0,0 +1,294 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// failingCache answers every read with err and passes writes to the memory cache
+type failingCache struct {
+	*MemoryCache
+	err error
+}
+
+func (c failingCache) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return nil, 0, c.err
+}
+
+// countingLoader returns a loader that counts its calls and returns value, or err if set
+func countingLoader(value string, err error) (func(context.Context) (string, error), *atomic.Int64) {
+	calls := &atomic.Int64{}
+	return func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		if err != nil {
+			return "", err
+		}
+		return value, nil
+	}, calls
+}
+
+func TestReadThroughFetch(t *testing.T) {
+	errLoad := errors.New("mongo unavailable")
+
+	tests := []struct {
+		name       string
+		cached     string // raw entry stored under the key beforehand, if any
+		readErr    error  // error every cache read fails with, if any
+		loadErr    error
+		wantValue  string
+		wantSource Source
+		wantErr    error
+		wantLoads  int64
+		wantStored string // entry under the key afterwards, empty for none
+		wantStats  Stats
+	}{
+		{
+			name:       "hit",
+			cached:     `"cached"`,
+			wantValue:  "cached",
+			wantSource: SourceCache,
+			wantStored: `"cached"`,
+			wantStats:  Stats{Hits: 1},
+		},
+		{
+			name:       "miss",
+			wantValue:  "loaded",
+			wantSource: SourceDatabase,
+			wantLoads:  1,
+			wantStored: `"loaded"`,
+			wantStats:  Stats{Misses: 1, Loads: 1},
+		},
+		{
+			name:       "redis.Nil is a miss",
+			readErr:    redis.Nil,
+			wantValue:  "loaded",
+			wantSource: SourceDatabase,
+			wantLoads:  1,
+			wantStored: `"loaded"`,
+			wantStats:  Stats{Misses: 1, Loads: 1},
+		},
+		{
+			name:       "outage falls back to the loader without writing back",
+			readErr:    errors.New("dial tcp: connection refused"),
+			wantValue:  "loaded",
+			wantSource: SourceDatabase,
+			wantLoads:  1,
+			wantStats:  Stats{Misses: 1, Loads: 1},
+		},
+		{
+			name:       "corrupt entry is replaced",
+			cached:     `{not json`,
+			wantValue:  "loaded",
+			wantSource: SourceDatabase,
+			wantLoads:  1,
+			wantStored: `"loaded"`,
+			wantStats:  Stats{Misses: 1, Loads: 1},
+		},
+		{
+			name:       "loader error is returned and not cached",
+			loadErr:    errLoad,
+			wantSource: SourceDatabase,
+			wantErr:    errLoad,
+			wantLoads:  1,
+			wantStats:  Stats{Misses: 1, Loads: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := NewMemoryCache()
+			if tt.cached != "" {
+				if err := memory.Set(ctx, "key", []byte(tt.cached), time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var cache Cache = memory
+			if tt.readErr != nil {
+				cache = failingCache{MemoryCache: memory, err: tt.readErr}
+			}
+			load, calls := countingLoader("loaded", tt.loadErr)
+			r := NewReadThrough[string](cache, nil, nil, time.Minute)
+
+			value, source, err := r.Fetch(ctx, "key", load)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if value != tt.wantValue || source != tt.wantSource {
+				t.Errorf("got %q from %s, want %q from %s", value, source, tt.wantValue, tt.wantSource)
+			}
+			if got := calls.Load(); got != tt.wantLoads {
+				t.Errorf("loader called %d times, want %d", got, tt.wantLoads)
+			}
+			stored, err := memory.Get(ctx, "key")
+			if err != nil && !errors.Is(err, ErrMiss) {
+				t.Fatal(err)
+			}
+			if string(stored) != tt.wantStored {
+				t.Errorf("cache holds %q, want %q", stored, tt.wantStored)
+			}
+			if got := r.Stats(); got != tt.wantStats {
+				t.Errorf("stats %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReadThroughCollapsesConcurrentMisses(t *testing.T) {
+	const callers = 8
+	r := NewReadThrough[string](NewMemoryCache(), nil, nil, time.Minute)
+
+	release := make(chan struct{})
+	var calls atomic.Int64
+	load := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+
+	type result struct {
+		value  string
+		source Source
+		err    error
+	}
+	results := make(chan result, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			value, source, err := r.Fetch(context.Background(), "key", load)
+			results <- result{value, source, err}
+		}()
+	}
+	waitFor(t, "every caller to miss", func() bool { return r.Stats().Misses == callers })
+	// Give the last caller time to join the load after counting its miss
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < callers; i++ {
+		res := <-results
+		if res.err != nil || res.value != "loaded" || res.source != SourceDatabase {
+			t.Errorf("caller got %q from %s with error %v, want the loaded value", res.value, res.source, res.err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+	if got := r.Stats(); got.Loads != 1 || got.Collapsed != callers-1 {
+		t.Errorf("stats %+v, want 1 load and %d collapsed", got, callers-1)
+	}
+}
+
+func TestReadThroughLoadOutlivesCancelledCaller(t *testing.T) {
+	memory := NewMemoryCache()
+	r := NewReadThrough[string](memory, nil, nil, time.Minute)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loadErr := make(chan error, 1)
+	load := func(ctx context.Context) (string, error) {
+		close(started)
+		<-release
+		loadErr <- ctx.Err()
+		return "loaded", nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fetched := make(chan error, 1)
+	go func() {
+		_, _, err := r.Fetch(ctx, "key", load)
+		fetched <- err
+	}()
+	<-started
+	cancel()
+	if err := <-fetched; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got error %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-loadErr; err != nil {
+		t.Fatalf("load saw a done context after its caller left: %v", err)
+	}
+	waitFor(t, "write-back", func() bool {
+		_, err := memory.Get(context.Background(), "key")
+		return err == nil
+	})
+
+	next, calls := countingLoader("reloaded", nil)
+	value, source, err := r.Fetch(context.Background(), "key", next)
+	if err != nil || value != "loaded" || source != SourceCache || calls.Load() != 0 {
+		t.Errorf("next read got %q from %s with error %v after %d loads, want the detached load's value from the cache",
+			value, source, err, calls.Load())
+	}
+}
+
+func TestReadThroughEarlyRefresh(t *testing.T) {
+	tests := []struct {
+		name        string
+		beta        float64
+		wantRefresh bool
+	}{
+		{name: "disabled", beta: 0},
+		// A huge beta makes every hit fall inside the refresh window
+		{name: "enabled", beta: 1e12, wantRefresh: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := NewMemoryCache()
+			r := NewReadThrough[string](memory, nil, nil, time.Minute).WithEarlyRefresh(tt.beta)
+
+			var calls atomic.Int64
+			load := func(ctx context.Context) (string, error) {
+				n := calls.Add(1)
+				// Take measurable time so the loader duration feeds XFetch
+				time.Sleep(time.Millisecond)
+				if n == 1 {
+					return "first", nil
+				}
+				return "refreshed", nil
+			}
+
+			if _, source, err := r.Fetch(ctx, "key", load); err != nil || source != SourceDatabase {
+				t.Fatalf("first read from %s with error %v, want a load", source, err)
+			}
+			value, source, err := r.Fetch(ctx, "key", load)
+			if err != nil || value != "first" || source != SourceCache {
+				t.Fatalf("second read got %q from %s with error %v, want the cached value", value, source, err)
+			}
+
+			if tt.wantRefresh {
+				waitFor(t, "early refresh", func() bool { return r.Stats().EarlyRefreshes == 1 })
+				stored, err := memory.Get(ctx, "key")
+				if err != nil || string(stored) != `"refreshed"` {
+					t.Errorf("cache holds %q (error %v), want the refreshed value", stored, err)
+				}
+			} else {
+				// Leave time for any refresh the hit might have started
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			want := Stats{Hits: 1, Misses: 1, Loads: 1}
+			if tt.wantRefresh {
+				want.Loads, want.EarlyRefreshes = 2, 1
+			}
+			if got := r.Stats(); got != want {
+				t.Errorf("stats %+v, want %+v", got, want)
+			}
+		})
+	}
+}
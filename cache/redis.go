@@ -2,23 +2,162 @@ package cache
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"query-service/config"
+	"query-service/logging"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
 var RedisClient *redis.Client
 
-func InitRedis() {
-	RedisClient = redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-	})
+func InitRedis(cfg config.RedisConfig) {
+	opts, err := redis.ParseURL(cfg.URI)
+	if err != nil {
+		logging.Fatal("invalid Redis URI", logging.Err(err))
+	}
+	RedisClient = redis.NewClient(opts)
 
 	ctx := context.Background()
-	_, err := RedisClient.Ping(ctx).Result()
+	_, err = RedisClient.Ping(ctx).Result()
+	if err != nil {
+		logging.Fatal("failed to connect to Redis", logging.Err(err))
+	}
+
+	slog.Info("Redis initialized")
+}
+
+// PingRedis checks that Redis answers
+func PingRedis(ctx context.Context) error {
+	return RedisClient.Ping(ctx).Err()
+}
+
+// CloseRedis closes the Redis client and its connection pool
+func CloseRedis() error {
+	return RedisClient.Close()
+}
+
+// addToTagScript adds ARGV[1] to the tag set KEYS[1]. A tag set's expiry is only ever
+// extended, so it outlives every member recorded in it. It touches no other key, so each
+// tag may live on a different Redis Cluster node than the entry.
+var addToTagScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+redis.call('SADD', KEYS[1], ARGV[1])
+if ttl > 0 then
+	-- PTTL is -1 for a freshly created set
+	local current = redis.call('PTTL', KEYS[1])
+	if current < ttl then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+else
+	redis.call('PERSIST', KEYS[1])
+end
+return 1
+`)
+
+// invalidateBatchSize bounds how many deletes InvalidateTags sends in one pipeline
+const invalidateBatchSize = 500
+
+// RedisCache implements Cache on top of a Redis client
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache wraps a Redis client as a Cache
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (c *RedisCache) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	pipe := c.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	value, err := get.Bytes()
+	if err == redis.Nil {
+		return nil, 0, ErrMiss
+	}
 	if err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		return nil, 0, err
+	}
+
+	// PTTL reports -1 for keys without an expiry
+	remaining := ttl.Val()
+	if remaining < 0 {
+		remaining = 0
+	}
+	return value, remaining, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) Del(ctx context.Context, keys ...string) error {
+	return c.client.Del(ctx, keys...).Err()
+}
+
+func (c *RedisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return c.client.Incr(ctx, key).Result()
+}
+
+func (c *RedisCache) SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	// Write the entry before tagging it, so an invalidation running in between leaves it
+	// tagged for the next one rather than untagged until it expires
+	pipe := c.client.Pipeline()
+	pipe.Set(ctx, key, value, ttl)
+	for _, tag := range tags {
+		addToTagScript.Eval(ctx, pipe, []string{tag}, key, ttl.Milliseconds())
 	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
 
-	log.Println("✅ Redis initialized")
-}
\ No newline at end of file
+// InvalidateTags deletes every member of each tag set, then the sets. Members are read
+// first and deleted one key per command: a script deleting keys it was not given, or a
+// DEL spanning keys, would fail on Redis Cluster.
+func (c *RedisCache) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	members := make([]*redis.StringSliceCmd, len(tags))
+	for i, tag := range tags {
+		members[i] = pipe.SMembers(ctx, tag)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// The sets go last, so a failed batch leaves them in place for a later invalidation
+	var keys []string
+	for _, cmd := range members {
+		keys = append(keys, cmd.Val()...)
+	}
+	keys = append(keys, tags...)
+
+	for start := 0; start < len(keys); start += invalidateBatchSize {
+		end := min(start+invalidateBatchSize, len(keys))
+		pipe := c.client.Pipeline()
+		for _, key := range keys[start:end] {
+			pipe.Del(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"query-service/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracedCache records a span around every call to the wrapped cache. Misses are an
+// expected outcome and are not marked as errors.
+type TracedCache struct {
+	Cache
+}
+
+func NewTracedCache(c Cache) *TracedCache {
+	return &TracedCache{Cache: c}
+}
+
+func (c *TracedCache) Get(ctx context.Context, key string) (value []byte, err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "GET", attribute.String("cache.key", key))
+	defer func() { tracing.End(span, err, ErrMiss) }()
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *TracedCache) GetWithTTL(ctx context.Context, key string) (value []byte, ttl time.Duration, err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "GET", attribute.String("cache.key", key))
+	defer func() { tracing.End(span, err, ErrMiss) }()
+	return c.Cache.GetWithTTL(ctx, key)
+}
+
+func (c *TracedCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "SET", attribute.String("cache.key", key))
+	defer func() { tracing.End(span, err) }()
+	return c.Cache.Set(ctx, key, value, ttl)
+}
+
+func (c *TracedCache) Del(ctx context.Context, keys ...string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "DEL", attribute.StringSlice("cache.keys", keys))
+	defer func() { tracing.End(span, err) }()
+	return c.Cache.Del(ctx, keys...)
+}
+
+func (c *TracedCache) Incr(ctx context.Context, key string) (n int64, err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "INCR", attribute.String("cache.key", key))
+	defer func() { tracing.End(span, err) }()
+	return c.Cache.Incr(ctx, key)
+}
+
+func (c *TracedCache) SetWithTags(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "SetWithTags", attribute.String("cache.key", key), attribute.StringSlice("cache.tags", tags))
+	defer func() { tracing.End(span, err) }()
+	return c.Cache.SetWithTags(ctx, key, value, ttl, tags...)
+}
+
+func (c *TracedCache) InvalidateTags(ctx context.Context, tags ...string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "redis", "InvalidateTags", attribute.StringSlice("cache.tags", tags))
+	defer func() { tracing.End(span, err) }()
+	return c.Cache.InvalidateTags(ctx, tags...)
+}
@@ -0,0 +1,491 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the service needs to start
+type Config struct {
+	Server        ServerConfig        `yaml:"server" json:"server"`
+	API           APIConfig           `yaml:"api" json:"api"`
+	Mongo         MongoConfig         `yaml:"mongo" json:"mongo"`
+	Redis         RedisConfig         `yaml:"redis" json:"redis"`
+	Cache         CacheConfig         `yaml:"cache" json:"cache"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch" json:"elasticsearch"`
+	Reindex       ReindexConfig       `yaml:"reindex" json:"reindex"`
+	Kafka         KafkaConfig         `yaml:"kafka" json:"kafka"`
+	Health        HealthConfig        `yaml:"health" json:"health"`
+	Tracing       TracingConfig       `yaml:"tracing" json:"tracing"`
+	Log           LogConfig           `yaml:"log" json:"log"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr" json:"addr"`
+	// ShutdownTimeout bounds draining HTTP requests, stopping the consumer and closing clients
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" json:"shutdownTimeout"`
+}
+
+// APIConfig bounds what clients may request from list endpoints
+type APIConfig struct {
+	// DefaultPageSize is used when a list request has no size parameter
+	DefaultPageSize int `yaml:"defaultPageSize" json:"defaultPageSize"`
+	// MaxPageSize is the largest size a list request may ask for
+	MaxPageSize int `yaml:"maxPageSize" json:"maxPageSize"`
+	// CursorSecret signs list cursors. When empty a random key is used, so cursors stop
+	// working on restart and are not accepted by other replicas.
+	CursorSecret string `yaml:"cursorSecret" json:"cursorSecret"`
+	// AdminToken is the bearer token the admin endpoints require. When empty the admin
+	// endpoints are not served.
+	AdminToken string `yaml:"adminToken" json:"adminToken"`
+}
+
+type MongoConfig struct {
+	URI            string   `yaml:"uri" json:"uri"`
+	Database       string   `yaml:"database" json:"database"`
+	ConnectTimeout Duration `yaml:"connectTimeout" json:"connectTimeout"`
+}
+
+type RedisConfig struct {
+	URI string `yaml:"uri" json:"uri"`
+}
+
+// CacheConfig sets how long each entity type stays cached
+type CacheConfig struct {
+	ProductTTL   Duration `yaml:"productTTL" json:"productTTL"`
+	InventoryTTL Duration `yaml:"inventoryTTL" json:"inventoryTTL"`
+	OrderTTL     Duration `yaml:"orderTTL" json:"orderTTL"`
+	CustomerTTL  Duration `yaml:"customerTTL" json:"customerTTL"`
+	ListTTL      Duration `yaml:"listTTL" json:"listTTL"`
+	// SuggestTTL is kept short since suggestions aren't invalidated when products change
+	SuggestTTL Duration `yaml:"suggestTTL" json:"suggestTTL"`
+	// EarlyRefreshBeta enables XFetch early refresh of hot entries when above zero
+	EarlyRefreshBeta float64 `yaml:"earlyRefreshBeta" json:"earlyRefreshBeta"`
+}
+
+type ElasticsearchConfig struct {
+	Addresses []string `yaml:"addresses" json:"addresses"`
+	// SynonymsFile is where the service manages the synonyms file Elasticsearch reads,
+	// usually a volume shared with every Elasticsearch node
+	SynonymsFile string `yaml:"synonymsFile" json:"synonymsFile"`
+}
+
+// ReindexConfig tunes how a reindex copies products from MongoDB into Elasticsearch
+type ReindexConfig struct {
+	// BatchSize is how many products go into each _bulk request
+	BatchSize int `yaml:"batchSize" json:"batchSize"`
+	// Concurrency is how many _bulk requests are in flight at once
+	Concurrency int `yaml:"concurrency" json:"concurrency"`
+	// ProgressInterval is how often progress is logged
+	ProgressInterval Duration `yaml:"progressInterval" json:"progressInterval"`
+}
+
+type KafkaConfig struct {
+	Brokers []string    `yaml:"brokers" json:"brokers"`
+	Topic   string      `yaml:"topic" json:"topic"`
+	GroupID string      `yaml:"groupId" json:"groupId"`
+	Retry   RetryConfig `yaml:"retry" json:"retry"`
+	// Workers is how many messages are handled concurrently; messages with the same key are handled one at a time
+	Workers int `yaml:"workers" json:"workers"`
+	// ProcessedEventRetention is how long processed event IDs are remembered for deduplication
+	ProcessedEventRetention Duration `yaml:"processedEventRetention" json:"processedEventRetention"`
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds each dependency ping
+	CheckTimeout Duration `yaml:"checkTimeout" json:"checkTimeout"`
+	// MaxConsumerLag is the uncommitted message count above which the service reports
+	// not ready; 0 disables the check
+	MaxConsumerLag int `yaml:"maxConsumerLag" json:"maxConsumerLag"`
+}
+
+type TracingConfig struct {
+	// Exporter is one of none, stdout, file (OTLP JSON lines) or otlp (OTLP over HTTP)
+	Exporter    string  `yaml:"exporter" json:"exporter"`
+	File        string  `yaml:"file" json:"file"`
+	Endpoint    string  `yaml:"endpoint" json:"endpoint"`
+	ServiceName string  `yaml:"serviceName" json:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio" json:"sampleRatio"`
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `yaml:"level" json:"level"`
+	// Format is json or text
+	Format string `yaml:"format" json:"format"`
+}
+
+type RetryConfig struct {
+	MaxRetries     int      `yaml:"maxRetries" json:"maxRetries"`
+	InitialBackoff Duration `yaml:"initialBackoff" json:"initialBackoff"`
+	MaxBackoff     Duration `yaml:"maxBackoff" json:"maxBackoff"`
+	BackoffFactor  float64  `yaml:"backoffFactor" json:"backoffFactor"`
+}
+
+// Default returns the configuration used for local development
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":8081",
+			ShutdownTimeout: Duration{10 * time.Second},
+		},
+		API: APIConfig{
+			DefaultPageSize: 10,
+			MaxPageSize:     100,
+		},
+		Mongo: MongoConfig{
+			URI:            "mongodb://localhost:27017",
+			Database:       "query_service",
+			ConnectTimeout: Duration{10 * time.Second},
+		},
+		Redis: RedisConfig{
+			URI: "redis://localhost:6379",
+		},
+		Cache: CacheConfig{
+			ProductTTL:   Duration{time.Hour},
+			InventoryTTL: Duration{10 * time.Minute},
+			OrderTTL:     Duration{10 * time.Minute},
+			CustomerTTL:  Duration{10 * time.Minute},
+			ListTTL:      Duration{5 * time.Minute},
+			SuggestTTL:   Duration{30 * time.Second},
+		},
+		Elasticsearch: ElasticsearchConfig{
+			Addresses:    []string{"http://localhost:9200"},
+			SynonymsFile: "analysis/product_synonyms.txt",
+		},
+		Reindex: ReindexConfig{
+			BatchSize:        500,
+			Concurrency:      4,
+			ProgressInterval: Duration{10 * time.Second},
+		},
+		Kafka: KafkaConfig{
+			Brokers: []string{"localhost:9092"},
+			Topic:   "query-service-events",
+			GroupID: "query-service-group",
+			Retry: RetryConfig{
+				MaxRetries:     3,
+				InitialBackoff: Duration{500 * time.Millisecond},
+				MaxBackoff:     Duration{10 * time.Second},
+				BackoffFactor:  2.0,
+			},
+			Workers:                 4,
+			ProcessedEventRetention: Duration{7 * 24 * time.Hour},
+		},
+		Health: HealthConfig{
+			CheckTimeout:   Duration{2 * time.Second},
+			MaxConsumerLag: 10000,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			File:        "traces.jsonl",
+			Endpoint:    "localhost:4318",
+			ServiceName: "query-service",
+			SampleRatio: 1,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// Load builds the configuration from defaults, an optional YAML/JSON file
+// and environment variables, in that order of precedence. When path is empty
+// the CONFIG_FILE environment variable is used instead.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// Report malformed environment values together with validation failures
+	envErr := applyEnv(&cfg)
+	if err := errors.Join(envErr, cfg.Validate()); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or JSON file on top of cfg, picking the format from the extension
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file extension: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with any environment variables that are set
+func applyEnv(cfg *Config) error {
+	var errs []error
+
+	setString := func(key string, dst *string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	setList := func(key string, dst *[]string) {
+		if v, ok := os.LookupEnv(key); ok {
+			*dst = splitList(v)
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v, ok := os.LookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid integer %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if v, ok := os.LookupEnv(key); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid number %q", key, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	setDuration := func(key string, dst *time.Duration) {
+		if v, ok := os.LookupEnv(key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid duration %q", key, v))
+				return
+			}
+			*dst = d
+		}
+	}
+
+	setString("HTTP_ADDR", &cfg.Server.Addr)
+	setDuration("HTTP_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout.Duration)
+	setInt("API_DEFAULT_PAGE_SIZE", &cfg.API.DefaultPageSize)
+	setInt("API_MAX_PAGE_SIZE", &cfg.API.MaxPageSize)
+	setString("API_CURSOR_SECRET", &cfg.API.CursorSecret)
+	setString("API_ADMIN_TOKEN", &cfg.API.AdminToken)
+	setString("MONGO_URI", &cfg.Mongo.URI)
+	setString("MONGO_DATABASE", &cfg.Mongo.Database)
+	setDuration("MONGO_CONNECT_TIMEOUT", &cfg.Mongo.ConnectTimeout.Duration)
+	setString("REDIS_URI", &cfg.Redis.URI)
+	setDuration("CACHE_PRODUCT_TTL", &cfg.Cache.ProductTTL.Duration)
+	setDuration("CACHE_INVENTORY_TTL", &cfg.Cache.InventoryTTL.Duration)
+	setDuration("CACHE_ORDER_TTL", &cfg.Cache.OrderTTL.Duration)
+	setDuration("CACHE_CUSTOMER_TTL", &cfg.Cache.CustomerTTL.Duration)
+	setDuration("CACHE_LIST_TTL", &cfg.Cache.ListTTL.Duration)
+	setDuration("CACHE_SUGGEST_TTL", &cfg.Cache.SuggestTTL.Duration)
+	setFloat("CACHE_EARLY_REFRESH_BETA", &cfg.Cache.EarlyRefreshBeta)
+	setList("ELASTICSEARCH_URI", &cfg.Elasticsearch.Addresses)
+	setString("ELASTICSEARCH_SYNONYMS_FILE", &cfg.Elasticsearch.SynonymsFile)
+	setInt("REINDEX_BATCH_SIZE", &cfg.Reindex.BatchSize)
+	setInt("REINDEX_CONCURRENCY", &cfg.Reindex.Concurrency)
+	setDuration("REINDEX_PROGRESS_INTERVAL", &cfg.Reindex.ProgressInterval.Duration)
+	setList("KAFKA_BROKER", &cfg.Kafka.Brokers)
+	setString("KAFKA_TOPIC", &cfg.Kafka.Topic)
+	setString("KAFKA_GROUP_ID", &cfg.Kafka.GroupID)
+	setInt("KAFKA_MAX_RETRIES", &cfg.Kafka.Retry.MaxRetries)
+	setDuration("KAFKA_INITIAL_BACKOFF", &cfg.Kafka.Retry.InitialBackoff.Duration)
+	setDuration("KAFKA_MAX_BACKOFF", &cfg.Kafka.Retry.MaxBackoff.Duration)
+	setFloat("KAFKA_BACKOFF_FACTOR", &cfg.Kafka.Retry.BackoffFactor)
+	setInt("KAFKA_WORKERS", &cfg.Kafka.Workers)
+	setDuration("KAFKA_PROCESSED_EVENT_RETENTION", &cfg.Kafka.ProcessedEventRetention.Duration)
+	setDuration("HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout.Duration)
+	setInt("HEALTH_MAX_CONSUMER_LAG", &cfg.Health.MaxConsumerLag)
+	setString("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	setString("TRACING_FILE", &cfg.Tracing.File)
+	setString("TRACING_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	setString("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	setFloat("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setString("LOG_FORMAT", &cfg.Log.Format)
+
+	return errors.Join(errs...)
+}
+
+// Validate checks every field and reports all problems in a single error
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr: must not be empty"))
+	}
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("server.shutdownTimeout: must be positive"))
+	}
+
+	if c.API.DefaultPageSize < 1 {
+		errs = append(errs, errors.New("api.defaultPageSize: must be at least 1"))
+	}
+	if c.API.MaxPageSize < c.API.DefaultPageSize {
+		errs = append(errs, errors.New("api.maxPageSize: must be at least defaultPageSize"))
+	}
+
+	if u, err := url.Parse(c.Mongo.URI); err != nil || (u.Scheme != "mongodb" && u.Scheme != "mongodb+srv") {
+		errs = append(errs, fmt.Errorf("mongo.uri: %q is not a mongodb:// or mongodb+srv:// URI", c.Mongo.URI))
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("mongo.database: must not be empty"))
+	}
+	if c.Mongo.ConnectTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("mongo.connectTimeout: must be positive"))
+	}
+
+	if u, err := url.Parse(c.Redis.URI); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		errs = append(errs, fmt.Errorf("redis.uri: %q is not a redis:// or rediss:// URI", c.Redis.URI))
+	}
+
+	for _, ttl := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"cache.productTTL", c.Cache.ProductTTL.Duration},
+		{"cache.inventoryTTL", c.Cache.InventoryTTL.Duration},
+		{"cache.orderTTL", c.Cache.OrderTTL.Duration},
+		{"cache.customerTTL", c.Cache.CustomerTTL.Duration},
+		{"cache.listTTL", c.Cache.ListTTL.Duration},
+		{"cache.suggestTTL", c.Cache.SuggestTTL.Duration},
+	} {
+		if ttl.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be positive", ttl.name))
+		}
+	}
+
+	if c.Cache.EarlyRefreshBeta < 0 {
+		errs = append(errs, errors.New("cache.earlyRefreshBeta: must not be negative"))
+	}
+
+	if len(c.Elasticsearch.Addresses) == 0 {
+		errs = append(errs, errors.New("elasticsearch.addresses: at least one address is required"))
+	}
+	for i, addr := range c.Elasticsearch.Addresses {
+		if u, err := url.Parse(addr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("elasticsearch.addresses[%d]: %q is not an http(s) URL", i, addr))
+		}
+	}
+	if c.Elasticsearch.SynonymsFile == "" {
+		errs = append(errs, errors.New("elasticsearch.synonymsFile: is required"))
+	}
+
+	if c.Reindex.BatchSize < 1 || c.Reindex.BatchSize > 10000 {
+		errs = append(errs, errors.New("reindex.batchSize: must be between 1 and 10000"))
+	}
+	if c.Reindex.Concurrency < 1 {
+		errs = append(errs, errors.New("reindex.concurrency: must be at least 1"))
+	}
+	if c.Reindex.ProgressInterval.Duration <= 0 {
+		errs = append(errs, errors.New("reindex.progressInterval: must be positive"))
+	}
+
+	if len(c.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers: at least one broker is required"))
+	}
+	for i, broker := range c.Kafka.Brokers {
+		if !strings.Contains(broker, ":") {
+			errs = append(errs, fmt.Errorf("kafka.brokers[%d]: %q must be host:port", i, broker))
+		}
+	}
+	if c.Kafka.Topic == "" {
+		errs = append(errs, errors.New("kafka.topic: must not be empty"))
+	}
+	if c.Kafka.GroupID == "" {
+		errs = append(errs, errors.New("kafka.groupId: must not be empty"))
+	}
+	if c.Kafka.Retry.MaxRetries < 0 {
+		errs = append(errs, errors.New("kafka.retry.maxRetries: must not be negative"))
+	}
+	if c.Kafka.Retry.InitialBackoff.Duration <= 0 {
+		errs = append(errs, errors.New("kafka.retry.initialBackoff: must be positive"))
+	}
+	if c.Kafka.Retry.MaxBackoff.Duration < c.Kafka.Retry.InitialBackoff.Duration {
+		errs = append(errs, errors.New("kafka.retry.maxBackoff: must be at least initialBackoff"))
+	}
+	if c.Kafka.Retry.BackoffFactor < 1 {
+		errs = append(errs, errors.New("kafka.retry.backoffFactor: must be at least 1"))
+	}
+	if c.Kafka.Workers < 1 {
+		errs = append(errs, errors.New("kafka.workers: must be at least 1"))
+	}
+	if c.Kafka.ProcessedEventRetention.Duration < time.Second {
+		errs = append(errs, errors.New("kafka.processedEventRetention: must be at least 1s"))
+	}
+
+	if c.Health.CheckTimeout.Duration <= 0 {
+		errs = append(errs, errors.New("health.checkTimeout: must be positive"))
+	}
+	if c.Health.MaxConsumerLag < 0 {
+		errs = append(errs, errors.New("health.maxConsumerLag: must not be negative"))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	case "file":
+		if c.Tracing.File == "" {
+			errs = append(errs, errors.New("tracing.file: must not be empty when the exporter is file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: %q is not one of none, stdout, file, otlp", c.Tracing.Exporter))
+	}
+	if c.Tracing.Exporter == "otlp" && c.Tracing.Endpoint == "" {
+		errs = append(errs, errors.New("tracing.endpoint: must not be empty when the exporter is otlp"))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sampleRatio: must be between 0 and 1"))
+	}
+	if c.Tracing.ServiceName == "" {
+		errs = append(errs, errors.New("tracing.serviceName: must not be empty"))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: %q is not one of debug, info, warn, error", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format: %q is not one of json, text", c.Log.Format))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping blanks
+func splitList(v string) []string {
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
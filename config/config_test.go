@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with the given name and contents to a temporary directory
+func writeConfig(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+	}{
+		{
+			name:     "JSON strings",
+			file:     "config.json",
+			contents: `{"server": {"shutdownTimeout": "15s"}, "cache": {"productTTL": "2h30m"}, "kafka": {"retry": {"initialBackoff": "250ms"}}}`,
+		},
+		{
+			name:     "JSON nanoseconds",
+			file:     "config.json",
+			contents: `{"server": {"shutdownTimeout": 15000000000}, "cache": {"productTTL": 9000000000000}, "kafka": {"retry": {"initialBackoff": 250000000}}}`,
+		},
+		{
+			name:     "YAML strings",
+			file:     "config.yaml",
+			contents: "server:\n  shutdownTimeout: 15s\ncache:\n  productTTL: 2h30m\nkafka:\n  retry:\n    initialBackoff: 250ms\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			if err := loadFile(writeConfig(t, tt.file, tt.contents), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.ShutdownTimeout.Duration != 15*time.Second ||
+				cfg.Cache.ProductTTL.Duration != 150*time.Minute ||
+				cfg.Kafka.Retry.InitialBackoff.Duration != 250*time.Millisecond {
+				t.Errorf("got shutdownTimeout %s, productTTL %s, initialBackoff %s, want 15s, 2h30m0s, 250ms",
+					cfg.Server.ShutdownTimeout, cfg.Cache.ProductTTL, cfg.Kafka.Retry.InitialBackoff)
+			}
+			// Fields the file leaves out keep their defaults
+			if cfg.Cache.OrderTTL != Default().Cache.OrderTTL {
+				t.Errorf("orderTTL %s, want the default %s", cfg.Cache.OrderTTL, Default().Cache.OrderTTL)
+			}
+		})
+	}
+}
+
+func TestLoadFileRejectsInvalidDuration(t *testing.T) {
+	for _, value := range []string{`"15"`, `"soon"`, `true`} {
+		cfg := Default()
+		err := loadFile(writeConfig(t, "config.json", `{"cache": {"productTTL": `+value+`}}`), &cfg)
+		if err == nil || !strings.Contains(err.Error(), "invalid duration") {
+			t.Errorf("productTTL %s: error %v, want an invalid duration", value, err)
+		}
+	}
+}
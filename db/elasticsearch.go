@@ -1,70 +1,50 @@
 package db
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"query-service/config"
+	"query-service/logging"
 
 	"github.com/elastic/go-elasticsearch/v8"
 )
 
 var ElasticsearchClient *elasticsearch.Client
 
-func InitElasticsearch() {
-    cfg := elasticsearch.Config{
-        Addresses: []string{"http://localhost:9200"},
-    }
-    client, err := elasticsearch.NewClient(cfg)
+// elasticsearchTransport is owned by the client so its connections can be closed on shutdown
+var elasticsearchTransport *http.Transport
+
+func InitElasticsearch(cfg config.ElasticsearchConfig) {
+    elasticsearchTransport = http.DefaultTransport.(*http.Transport).Clone()
+    client, err := elasticsearch.NewClient(elasticsearch.Config{
+        Addresses: cfg.Addresses,
+        Transport: elasticsearchTransport,
+    })
     if err != nil {
-        log.Fatalf("Failed to create Elasticsearch client: %v", err)
+        logging.Fatal("failed to create Elasticsearch client", logging.Err(err))
     }
 
     ElasticsearchClient = client
-    log.Println("✅ Elasticsearch initialized")
-
-    createProductIndex()
+    slog.Info("Elasticsearch initialized")
 }
 
-func createProductIndex() {
-    mapping := map[string]interface{}{
-        "settings": map[string]interface{}{
-            "analysis": map[string]interface{}{
-                "analyzer": map[string]interface{}{
-                    "custom_analyzer": map[string]interface{}{
-                        "type":      "custom",
-                        "tokenizer": "standard",
-                        "filter":    []string{"lowercase", "asciifolding"},
-                    },
-                },
-            },
-        },
-        "mappings": map[string]interface{}{
-            "properties": map[string]interface{}{
-                "name": map[string]interface{}{
-                    "type":     "text",
-                    "analyzer": "custom_analyzer",
-                },
-                "sku": map[string]interface{}{
-                    "type": "keyword",
-                },
-                "category": map[string]interface{}{
-                    "type": "keyword",
-                },
-                "price": map[string]interface{}{
-                    "type": "double",
-                },
-            },
-        },
-    }
-
-    body, _ := json.Marshal(mapping)
-    res, err := ElasticsearchClient.Indices.Create(
-        "products",
-        ElasticsearchClient.Indices.Create.WithBody(bytes.NewReader(body)),
-    )
+// PingElasticsearch checks that the cluster answers
+func PingElasticsearch(ctx context.Context) error {
+    res, err := ElasticsearchClient.Ping(ElasticsearchClient.Ping.WithContext(ctx))
     if err != nil {
-        log.Fatalf("Failed to create Elasticsearch index: %v", err)
+        return err
     }
     defer res.Body.Close()
-    log.Println("✅ Elasticsearch product index created")
+    if res.IsError() {
+        return fmt.Errorf("elasticsearch ping: %s", res.Status())
+    }
+    return nil
+}
+
+// CloseElasticsearch closes the idle connections of the Elasticsearch transport; the client
+// has no Close of its own
+func CloseElasticsearch() {
+    elasticsearchTransport.CloseIdleConnections()
 }
@@ -2,36 +2,57 @@ package db
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"query-service/config"
+	"query-service/logging"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+var MongoClient *mongo.Client
 var ProductCollection *mongo.Collection
 var OrderCollection *mongo.Collection
 var CustomerCollection *mongo.Collection
+var ProcessedEventCollection *mongo.Collection
+var ReindexCheckpointCollection *mongo.Collection
 
-func InitMongo() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func InitMongo(cfg config.MongoConfig) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout.Duration)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI))
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		logging.Fatal("failed to connect to MongoDB", logging.Err(err))
 	}
 
-	db := client.Database("query_service")
+	MongoClient = client
+	db := client.Database(cfg.Database)
 	ProductCollection = db.Collection("products")
 	OrderCollection = db.Collection("orders")
 	CustomerCollection = db.Collection("customers")
+	ProcessedEventCollection = db.Collection("processed_events")
+	ReindexCheckpointCollection = db.Collection("reindex_checkpoints")
+
+	slog.Info("MongoDB initialized")
+}
 
-	log.Println("✅ MongoDB initialized")
+// CloseMongo disconnects the MongoDB client, waiting for in-use connections until ctx is done
+func CloseMongo(ctx context.Context) error {
+	return MongoClient.Disconnect(ctx)
 }
 
-func CreateIndexes() {
+// PingMongo checks that the primary is reachable
+func PingMongo(ctx context.Context) error {
+	return MongoClient.Ping(ctx, readpref.Primary())
+}
+
+// CreateIndexes creates the unique lookup indexes, the list indexes and the TTL index
+// that expires processed-event ledger entries after retention
+func CreateIndexes(retention time.Duration) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -46,9 +67,21 @@ func CreateIndexes() {
 			Options: options.Index().SetUnique(true),
 		},
 	}
+	// Category listings for each sort field, paged by offset or by (field, productId)
+	// keyset. Price and inventory filters use the matching index's range.
+	for _, field := range []string{"created", "price", "name", "currentInventory"} {
+		productIndexes = append(productIndexes,
+			mongo.IndexModel{Keys: bson.D{{Key: "category.id", Value: 1}, {Key: field, Value: 1}, {Key: "productId", Value: 1}}},
+			mongo.IndexModel{Keys: bson.D{{Key: "category.parentCategory.id", Value: 1}, {Key: field, Value: 1}, {Key: "productId", Value: 1}}},
+		)
+	}
+	// Attribute filters match name/value pairs within the attributes array
+	productIndexes = append(productIndexes, mongo.IndexModel{
+		Keys: bson.D{{Key: "category.id", Value: 1}, {Key: "attributes.name", Value: 1}, {Key: "attributes.value", Value: 1}},
+	})
 	_, err := ProductCollection.Indexes().CreateMany(ctx, productIndexes)
 	if err != nil {
-		log.Fatalf("Failed to create product indexes: %v", err)
+		logging.Fatal("failed to create product indexes", logging.Err(err))
 	}
 
 	// Create indexes for orders
@@ -61,10 +94,14 @@ func CreateIndexes() {
 			Keys:    bson.D{{Key: "orderNumber", Value: 1}},
 			Options: options.Index().SetUnique(true),
 		},
+		{
+			// Customer order listings, paged by offset or by (created, orderId) keyset
+			Keys: bson.D{{Key: "customerId", Value: 1}, {Key: "created", Value: 1}, {Key: "orderId", Value: 1}},
+		},
 	}
 	_, err = OrderCollection.Indexes().CreateMany(ctx, orderIndexes)
 	if err != nil {
-		log.Fatalf("Failed to create order indexes: %v", err)
+		logging.Fatal("failed to create order indexes", logging.Err(err))
 	}
 
 	// Create indexes for customers
@@ -80,8 +117,17 @@ func CreateIndexes() {
 	}
 	_, err = CustomerCollection.Indexes().CreateMany(ctx, customerIndexes)
 	if err != nil {
-		log.Fatalf("Failed to create customer indexes: %v", err)
+		logging.Fatal("failed to create customer indexes", logging.Err(err))
+	}
+
+	// Expire processed-event ledger entries once redeliveries are no longer expected
+	_, err = ProcessedEventCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "processedAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+	})
+	if err != nil {
+		logging.Fatal("failed to create processed event indexes", logging.Err(err))
 	}
 
-	log.Println("✅ MongoDB indexes created")
+	slog.Info("MongoDB indexes created")
 }
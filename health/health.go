@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check pings one dependency and returns an error when it is unusable
+type Check func(ctx context.Context) error
+
+// LagFunc reports how many events the projection has yet to apply
+type LagFunc func(ctx context.Context) (int64, error)
+
+// Result is the outcome of a single dependency check
+type Result struct {
+	Status    string  `json:"status"`
+	Required  bool    `json:"required"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// LagResult reports the consumer lag against the readiness threshold
+type LagResult struct {
+	Messages int64  `json:"messages"`
+	Max      int64  `json:"max,omitempty"`
+	Exceeded bool   `json:"exceeded"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the state of every dependency at one point in time
+type Report struct {
+	Ready        bool              `json:"ready"`
+	Dependencies map[string]Result `json:"dependencies"`
+	ConsumerLag  *LagResult        `json:"consumerLag,omitempty"`
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	required bool
+}
+
+// Checker pings dependencies concurrently, each under its own timeout
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+	lagName string
+	lag     LagFunc
+	maxLag  int64
+}
+
+// NewChecker creates a checker whose pings are bounded by timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a dependency the service cannot serve without
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check, required: true})
+}
+
+// AddOptional registers a dependency that is reported but does not affect readiness,
+// e.g. a cache the handlers can fall back from
+func (c *Checker) AddOptional(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetConsumerLag registers the consumer lag lookup. It doubles as the optional check of
+// the named broker dependency; readiness fails when the lag exceeds maxLag (0 disables that).
+func (c *Checker) SetConsumerLag(name string, lag LagFunc, maxLag int64) {
+	c.lagName = name
+	c.lag = lag
+	c.maxLag = maxLag
+}
+
+// Run checks every dependency concurrently and reports readiness: every required
+// dependency is up and the consumer lag, when known, is within bounds
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Dependencies: make(map[string]Result, len(c.checks)+1)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			result := c.ping(ctx, nc.required, nc.check)
+			mu.Lock()
+			report.Dependencies[nc.name] = result
+			mu.Unlock()
+		}(nc)
+	}
+
+	if c.lag != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var messages int64
+			result := c.ping(ctx, false, func(ctx context.Context) error {
+				var err error
+				messages, err = c.lag(ctx)
+				return err
+			})
+			lag := &LagResult{Messages: messages, Max: c.maxLag, Error: result.Error}
+			lag.Exceeded = result.Status == StatusUp && c.maxLag > 0 && messages > c.maxLag
+			mu.Lock()
+			report.Dependencies[c.lagName] = result
+			report.ConsumerLag = lag
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	report.Ready = true
+	for _, result := range report.Dependencies {
+		if result.Required && result.Status != StatusUp {
+			report.Ready = false
+		}
+	}
+	if report.ConsumerLag != nil && report.ConsumerLag.Exceeded {
+		report.Ready = false
+	}
+	return report
+}
+
+// ping runs one check under the checker's timeout and measures its latency
+func (c *Checker) ping(ctx context.Context, required bool, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Result{
+		Status:    StatusUp,
+		Required:  required,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"query-service/logging"
+	"sync"
+	"time"
+)
+
+// StopFunc releases one component; it should return early once ctx is done
+type StopFunc func(ctx context.Context) error
+
+type hook struct {
+	name string
+	stop StopFunc
+}
+
+// Manager shuts components down in the reverse of the order they were registered, so
+// registering each component right after the ones it depends on closes dependents first
+type Manager struct {
+	mu    sync.Mutex
+	hooks []hook
+}
+
+// New creates an empty lifecycle manager
+func New() *Manager {
+	return &Manager{}
+}
+
+// OnShutdown registers a component to stop during Shutdown
+func (m *Manager) OnShutdown(name string, stop StopFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name: name, stop: stop})
+}
+
+// Shutdown stops every registered component in reverse order, logging how long each step
+// took. Every step runs even if an earlier one failed or the deadline passed, so clients
+// are still released; the failures are returned together.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := m.hooks
+	m.hooks = nil
+	m.mu.Unlock()
+
+	start := time.Now()
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		stepStart := time.Now()
+		if err := h.stop(ctx); err != nil {
+			slog.Error("failed to stop component",
+				slog.String("component", h.name),
+				logging.Duration(time.Since(stepStart)),
+				logging.Err(err),
+			)
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			continue
+		}
+		slog.Info("stopped component",
+			slog.String("component", h.name),
+			logging.Duration(time.Since(stepStart)),
+		)
+	}
+	slog.Info("shutdown finished", logging.Duration(time.Since(start)))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"query-service/config"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys shared by every log line so the pipeline can index them consistently
+const (
+	KeyError      = "error"
+	KeyRequestID  = "request_id"
+	KeyTopic      = "topic"
+	KeyPartition  = "partition"
+	KeyOffset     = "offset"
+	KeyKey        = "key"
+	KeyEventType  = "event_type"
+	KeyEventID    = "event_id"
+	KeyProductID  = "product_id"
+	KeyOrderID    = "order_id"
+	KeyCustomerID = "customer_id"
+	KeyCacheKey   = "cache_key"
+	KeyIndex      = "index"
+	KeyDuration   = "duration_ms"
+	KeyTraceID    = "trace_id"
+)
+
+// New builds the service logger writing to w
+func New(cfg config.LogConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch cfg.Format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// Err formats an error under the shared error key
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// Duration formats d in milliseconds under the shared duration key
+func Duration(d time.Duration) slog.Attr {
+	return slog.Float64(KeyDuration, float64(d.Microseconds())/1000)
+}
+
+// WithTraceID adds the trace ID of the span in ctx to logger, if there is one
+func WithTraceID(ctx context.Context, logger *slog.Logger) *slog.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return logger
+	}
+	return logger.With(slog.String(KeyTraceID, sc.TraceID().String()))
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying logger, usually one already enriched with
+// correlation attributes such as the request ID or the Kafka message coordinates
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Fatal logs msg at error level on the default logger and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
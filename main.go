@@ -2,76 +2,235 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"query-service/cache"
+	"query-service/config"
 	"query-service/db"
+	"query-service/health"
+	"query-service/lifecycle"
+	"query-service/logging"
 	"query-service/messaging"
+	"query-service/metrics"
+	"query-service/repository"
 	"query-service/routes"
+	"query-service/search"
+	"query-service/tracing"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	// Load configuration from the environment and optional config file
+	cfg, err := config.Load("")
+	if err != nil {
+		logging.Fatal("failed to load configuration", logging.Err(err))
+	}
+
+	// Log structured lines at the configured level; the standard log package goes through it too
+	logger, err := logging.New(cfg.Log, os.Stdout)
+	if err != nil {
+		logging.Fatal("failed to create logger", logging.Err(err))
+	}
+	slog.SetDefault(logger)
+
+	// The reindex subcommand rebuilds the search index and exits instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "reindex" {
+		if err := runReindex(cfg, os.Args[2:]); err != nil {
+			logging.Fatal("reindex failed", logging.Err(err))
+		}
+		return
+	}
+
+	// Components are stopped in the reverse of the order they are registered in
+	lc := lifecycle.New()
+
+	// Install the tracer first so it is flushed after everything that records spans
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Fatal("failed to initialize tracing", logging.Err(err))
+	}
+	lc.OnShutdown("tracer provider", shutdownTracing)
+
 	// Initialize connections
-	db.InitMongo()
-	cache.InitRedis()
-	db.InitElasticsearch()
+	db.InitMongo(cfg.Mongo)
+	lc.OnShutdown("MongoDB client", db.CloseMongo)
+	db.CreateIndexes(cfg.Kafka.ProcessedEventRetention.Duration)
+	cache.InitRedis(cfg.Redis)
+	lc.OnShutdown("Redis client", func(context.Context) error {
+		return cache.CloseRedis()
+	})
+	db.InitElasticsearch(cfg.Elasticsearch)
+	lc.OnShutdown("Elasticsearch transport", func(context.Context) error {
+		db.CloseElasticsearch()
+		return nil
+	})
+
+	// Wrap the clients in the interfaces the handlers depend on
+	products := repository.NewTracedProductRepository(repository.NewMongoProductRepository(db.ProductCollection))
+	orders := repository.NewTracedOrderRepository(repository.NewMongoOrderRepository(db.OrderCollection))
+	customers := repository.NewTracedCustomerRepository(repository.NewMongoCustomerRepository(db.CustomerCollection))
+	redisCache := cache.NewTracedCache(cache.NewInstrumentedCache(cache.NewRedisCache(cache.RedisClient)))
+	elasticsearchIndex := search.NewElasticsearchIndex(db.ElasticsearchClient, search.ProductsAlias)
+	searchIndex := search.NewTracedIndex(elasticsearchIndex)
+
+	// Put the product index template in place and make sure the alias points at an index
+	checkpoints := repository.NewTracedCheckpointStore(repository.NewMongoCheckpointStore(db.ReindexCheckpointCollection))
+	indices := search.NewIndexManager(elasticsearchIndex, products, checkpoints, cfg.Reindex)
+	indexCtx, cancelIndex := context.WithTimeout(context.Background(), 30*time.Second)
+	indexState, err := indices.Ensure(indexCtx)
+	cancelIndex()
+	if err != nil {
+		logging.Fatal("failed to prepare the product search index", logging.Err(err))
+	}
+	if !indexState.UpToDate && !indexState.Outdated() {
+		slog.Warn("product search index does not match the expected mapping; trigger a reindex through the admin API",
+			slog.String(logging.KeyIndex, indexState.Index),
+			slog.Any("diffs", indexState.Diffs),
+		)
+	}
+	lc.OnShutdown("search index manager", indices.Close)
 
 	// Configure and start Kafka consumer
 	consumer := messaging.NewConsumer(
-		[]string{"localhost:9092"},
-		"query-service-events",
-		"query-service-group",
+		cfg.Kafka.Brokers,
+		cfg.Kafka.Topic,
+		cfg.Kafka.GroupID,
 		messaging.RetryConfig{
-			MaxRetries:     3,
-			InitialBackoff: 500 * time.Millisecond,
-			MaxBackoff:     10 * time.Second,
-			BackoffFactor:  2.0,
+			MaxRetries:     cfg.Kafka.Retry.MaxRetries,
+			InitialBackoff: cfg.Kafka.Retry.InitialBackoff.Duration,
+			MaxBackoff:     cfg.Kafka.Retry.MaxBackoff.Duration,
+			BackoffFactor:  cfg.Kafka.Retry.BackoffFactor,
 		},
 	)
 
+	consumer.SetLogger(logger)
+
+	// Handle unrelated keys concurrently
+	consumer.SetWorkers(cfg.Kafka.Workers)
+
+	// Skip events that were already projected
+	consumer.SetLedger(repository.NewTracedEventLedger(repository.NewMongoEventLedger(db.ProcessedEventCollection)))
+
 	// Register event handlers
-	messaging.RegisterEventHandlers(consumer)
+	handlers := &messaging.EventHandlers{
+		Products:  products,
+		Orders:    orders,
+		Customers: customers,
+		Cache:     redisCache,
+		Search:    searchIndex,
+		TTL:       cfg.Cache,
+	}
+	messaging.RegisterEventHandlers(consumer, handlers)
+
+	// A reindex drops the cached copies of every product it copies
+	indices.SetBatchHook(handlers.InvalidateProducts)
+
+	// An outdated index serves searches without the fields and analyzers this build relies
+	// on, so rebuild it right away. Another replica may hold the reindex lock already.
+	if indexState.Outdated() {
+		attrs := []any{
+			slog.String(logging.KeyIndex, indexState.Index),
+			slog.Bool("legacy", indexState.Legacy),
+			slog.Int("version", indexState.Version),
+			slog.Any("diffs", indexState.Diffs),
+		}
+		lockCtx, cancelLock := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := indices.StartReindex(lockCtx, false)
+		cancelLock()
+		if err != nil {
+			slog.Warn("failed to start reindexing the outdated product search index", append(attrs, logging.Err(err))...)
+		} else {
+			slog.Info("reindexing the outdated product search index", attrs...)
+		}
+	}
 
 	// Start consumer in the background
 	consumer.Start()
+	lc.OnShutdown("Kafka consumer", consumer.Stop)
+
+	// Export the Kafka reader statistics alongside the other metrics
+	prometheus.MustRegister(metrics.NewKafkaReaderCollector(consumer.ReaderStats))
 
 	// Create a new Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.CustomRecovery(routes.Recovered), tracing.GinMiddleware(), logging.GinMiddleware(logger), metrics.GinMiddleware())
 
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "OK"})
-	})
+	// Expose Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Health check endpoints; Redis is optional since reads fall back to the database
+	checker := health.NewChecker(cfg.Health.CheckTimeout.Duration)
+	checker.Add("mongodb", db.PingMongo)
+	checker.Add("elasticsearch", db.PingElasticsearch)
+	checker.AddOptional("redis", cache.PingRedis)
+	checker.SetConsumerLag("kafka", consumer.Lag, int64(cfg.Health.MaxConsumerLag))
+	routes.RegisterHealthRoutes(r, checker)
+
+	if cfg.API.CursorSecret == "" {
+		slog.Warn("API_CURSOR_SECRET is not set; list cursors are signed with a random key and stop working on restart")
+	}
 
 	// API routes group
 	api := r.Group("/api/queries")
-	routes.RegisterRoutes(api)
+	routes.RegisterRoutes(api, routes.NewHandler(routes.Dependencies{
+		Products:  products,
+		Orders:    orders,
+		Customers: customers,
+		Cache:     redisCache,
+		Search:    searchIndex,
+		TTL:       cfg.Cache,
+		API:       cfg.API,
+	}))
+	// Admin routes are only served when a token is configured
+	if cfg.API.AdminToken != "" {
+		synonyms := search.NewSynonymSet(elasticsearchIndex, cfg.Elasticsearch.SynonymsFile)
+		routes.RegisterAdminRoutes(r.Group("/api/admin"), routes.NewAdminHandler(indices, synonyms), cfg.API.AdminToken)
+	} else {
+		slog.Info("API_ADMIN_TOKEN is not set; admin endpoints are disabled")
+	}
+	r.NoRoute(routes.NoRoute)
 
 	// Start the server in a goroutine
+	srv := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: r,
+	}
+	serveErr := make(chan error, 1)
 	go func() {
-		if err := r.Run(":8081"); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		logger.Info("HTTP server listening", slog.String("addr", cfg.Server.Addr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
 		}
 	}()
+	// Drain in-flight requests before anything they use is stopped
+	lc.OnShutdown("HTTP server", srv.Shutdown)
 
-	// Wait for interrupt signal to gracefully shut down
+	// Wait for interrupt signal (or a failed listener) to gracefully shut down
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
+	select {
+	case <-quit:
+	case err := <-serveErr:
+		logger.Error("HTTP server failed", logging.Err(err))
+	}
 
-	// Stop the consumer
-	consumer.Stop()
+	logger.Info("shutting down")
 
 	// Create a deadline for shutdown
-	_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
 	defer cancel()
 
-	log.Println("Server gracefully stopped")
+	if err := lc.Shutdown(ctx); err != nil {
+		logger.Error("shutdown completed with errors", logging.Err(err))
+		return
+	}
+	logger.Info("server gracefully stopped")
 }
@@ -3,177 +3,566 @@ package messaging
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
+	"query-service/logging"
+	"query-service/metrics"
+	"query-service/repository"
+	"query-service/tracing"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// messageReader is the subset of *kafka.Reader the consumer uses
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// messageWriter is the subset of *kafka.Writer used for the DLQ
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Consumer projects events from a Kafka topic with at-least-once semantics: a message's
+// offset is committed only after its handler succeeded, it was skipped as a duplicate, or
+// it was acknowledged by the DLQ. A crash before that point redelivers the message, which
+// is safe because handlers are idempotent and the ledger skips events already projected.
+//
+// Messages are handled by a pool of workers. Messages with the same key (or of the same
+// partition when they have none) are handled one at a time in fetch order, so events of
+// one aggregate keep their order while other keys proceed in parallel. A message waiting
+// to be retried holds back only the later messages of its key. Offsets are still
+// committed in order per partition: a message is committed only once it and every
+// earlier fetched message of its partition are done.
 type Consumer struct {
-    reader      *kafka.Reader
-    handlers    map[string]EventHandler
-    retryConfig RetryConfig
-    dlqWriter   *kafka.Writer
-    wg          sync.WaitGroup
-    stopChan    chan struct{}
+	reader      messageReader
+	topic       string
+	groupID     string
+	client      *kafka.Client // admin requests such as lag lookups
+	handlers    map[string]EventHandler
+	retryConfig RetryConfig
+	dlqWriter   messageWriter
+	ledger      repository.EventLedger
+	logger      *slog.Logger
+	workers     int
+	queue       *keyQueue
+	slots       chan struct{} // one per fetched message that is not finished yet
+	offsets     *offsetTracker
+	commitMu    sync.Mutex
+	wg          sync.WaitGroup
+	// ctx is the root of every handler, ledger and DLQ call; Stop cancels it once the
+	// workers finished or its deadline passed
+	ctx    context.Context
+	cancel context.CancelFunc
+	// fetchCtx is derived from ctx and bounds fetching; Stop cancels it first
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
 }
 
+const (
+	// inFlightPerWorker bounds how many fetched messages may be unfinished per worker;
+	// once they are all taken the consumer stops fetching until one finishes
+	inFlightPerWorker = 64
+	// commitTimeout bounds offset commits, which outlive the root context so work
+	// finished during shutdown is still committed
+	commitTimeout = 5 * time.Second
+)
+
 type RetryConfig struct {
-    MaxRetries     int
-    InitialBackoff time.Duration
-    MaxBackoff     time.Duration
-    BackoffFactor  float64
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	BackoffFactor  float64
 }
 
 type EventHandler func(context.Context, interface{}) error
 
+// delivery is a fetched message on its way through the workers, with its retry state
+type delivery struct {
+	entry   *pendingMessage
+	ctx     context.Context // carries the message's span and logger once it was started
+	span    trace.Span
+	event   Event
+	handler EventHandler  // set once the event was parsed and is due to be handled
+	attempt int           // handler attempts made so far
+	backoff time.Duration // wait before the next attempt
+	lastErr error
+}
+
+// step is what becomes of a message after a worker handled it
+type step int
+
+const (
+	// stepCommit finishes the message; its offset may be committed
+	stepCommit step = iota
+	// stepRetry queues the message for another handler attempt after its backoff
+	stepRetry
+	// stepAbandon finishes the message but leaves its offset uncommitted, so it is
+	// redelivered after a restart
+	stepAbandon
+)
+
 // NewConsumer creates a new Kafka consumer
 func NewConsumer(brokers []string, topic, groupID string, retryConfig RetryConfig) *Consumer {
-    reader := kafka.NewReader(kafka.ReaderConfig{
-        Brokers: []string{"localhost:9092"},
-        Topic:   topic,
-        GroupID: groupID,
-        // Set maximum wait time for new messages
-        MaxWait: 30 * time.Second,
-    })
-
-    // Setup DLQ writer
-    dlqWriter := &kafka.Writer{
-        Addr:         kafka.TCP(brokers...),
-        RequiredAcks: kafka.RequireAll,
-    }
-
-    return &Consumer{
-        reader:      reader,
-        handlers:    make(map[string]EventHandler),
-        retryConfig: retryConfig,
-        dlqWriter:   dlqWriter,
-        stopChan:    make(chan struct{}),
-    }
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		Topic:   topic,
+		GroupID: groupID,
+		// Set maximum wait time for new messages
+		MaxWait: 30 * time.Second,
+		// Commit synchronously so CommitMessages returns only once the offset is stored
+		CommitInterval: 0,
+	})
+
+	// Setup DLQ writer
+	dlqWriter := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	c := newConsumer(reader, dlqWriter, topic, retryConfig)
+	c.groupID = groupID
+	c.client = &kafka.Client{Addr: kafka.TCP(brokers...)}
+	return c
+}
+
+// newConsumer creates a consumer reading from reader and dead-lettering to dlqWriter
+func newConsumer(reader messageReader, dlqWriter messageWriter, topic string, retryConfig RetryConfig) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	fetchCtx, stopFetching := context.WithCancel(ctx)
+	return &Consumer{
+		reader:       reader,
+		topic:        topic,
+		handlers:     make(map[string]EventHandler),
+		retryConfig:  retryConfig,
+		dlqWriter:    dlqWriter,
+		logger:       slog.Default().With(slog.String(logging.KeyTopic, topic)),
+		workers:      1,
+		offsets:      newOffsetTracker(),
+		ctx:          ctx,
+		cancel:       cancel,
+		fetchCtx:     fetchCtx,
+		stopFetching: stopFetching,
+	}
 }
 
 // RegisterHandler registers a handler for a specific event type
 func (c *Consumer) RegisterHandler(eventType string, handler EventHandler) {
-    c.handlers[eventType] = handler
+	c.handlers[eventType] = handler
+}
+
+// SetLedger enables deduplication: events whose eventId is already in the ledger are skipped
+func (c *Consumer) SetLedger(ledger repository.EventLedger) {
+	c.ledger = ledger
+}
+
+// SetLogger sets the logger every message's log lines are derived from
+func (c *Consumer) SetLogger(logger *slog.Logger) {
+	c.logger = logger.With(slog.String(logging.KeyTopic, c.topic))
+}
+
+// SetWorkers sets how many messages are handled concurrently; it must be called before Start
+func (c *Consumer) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.workers = n
+}
+
+// ReaderStats returns the Kafka reader statistics; counters reset on every call
+func (c *Consumer) ReaderStats() kafka.ReaderStats {
+	return c.reader.Stats()
 }
 
 // Start begins consuming messages from Kafka
 func (c *Consumer) Start() {
-    c.wg.Add(1)
-    go func() {
-        defer c.wg.Done()
-        for {
-            select {
-            case <-c.stopChan:
-                log.Println("📢 Consumer shutting down...")
-                return
-            default:
-                c.processMessage()
-            }
-        }
-    }()
-    log.Println("✅ Kafka consumer started")
-}
-
-// processMessage reads and processes a single message from Kafka
-func (c *Consumer) processMessage() {
-    ctx := context.Background()
-    msg, err := c.reader.ReadMessage(ctx)
-    if err != nil {
-        log.Printf("⚠️ Failed to read Kafka message: %v", err)
-        time.Sleep(1 * time.Second) // Wait before retrying
-        return
-    }
-
-    log.Printf("📩 Received message: partition=%d offset=%d key=%s", 
-        msg.Partition, msg.Offset, string(msg.Key))
-
-    var event Event
-    if err := json.Unmarshal(msg.Value, &event); err != nil {
-        log.Printf("⚠️ Failed to parse Kafka message: %v", err)
-        c.sendToDLQ(msg, "parse_error", err.Error())
-        return
-    }
-
-    handler, exists := c.handlers[event.Type]
-    if !exists {
-        log.Printf("⚠️ No handler registered for event type: %s", event.Type)
-        c.sendToDLQ(msg, "no_handler", "No handler registered for this event type")
-        return
-    }
-
-    if err := c.processWithRetry(ctx, handler, event.Data); err != nil {
-        log.Printf("❌ Failed to process event after retries: %v", err)
-        c.sendToDLQ(msg, "processing_error", err.Error())
-        return
-    }
-
-    log.Printf("✅ Successfully processed event of type: %s", event.Type)
-}
-
-// processWithRetry attempts to process an event with exponential backoff retry
-func (c *Consumer) processWithRetry(ctx context.Context, handler EventHandler, data interface{}) error {
-    var lastErr error
-    backoff := c.retryConfig.InitialBackoff
-
-    // Try to process the event up to MaxRetries times
-    for attempt := 0; attempt <= c.retryConfig.MaxRetries; attempt++ {
-        // If this is a retry, log and wait
-        if attempt > 0 {
-            log.Printf("🔄 Retry attempt %d/%d after error: %v", 
-                attempt, c.retryConfig.MaxRetries, lastErr)
-            time.Sleep(backoff)
-            backoff = time.Duration(float64(backoff) * c.retryConfig.BackoffFactor)
-            if backoff > c.retryConfig.MaxBackoff {
-                backoff = c.retryConfig.MaxBackoff
-            }
-        }
-
-        // Process the event
-        err := handler(ctx, data)
-        if err == nil {
-            return nil // Success
-        }
-
-        lastErr = err
-    }
-
-    return lastErr
-}
-
-// sendToDLQ sends a failed message to the Dead Letter Queue
-func (c *Consumer) sendToDLQ(msg kafka.Message, errorType, errorDetail string) {
-    msg.Topic = c.reader.Config().Topic + "-dlq"
-    // Add error information to message headers
-    msg.Headers = append(msg.Headers,
-        kafka.Header{Key: "error_type", Value: []byte(errorType)},
-        kafka.Header{Key: "error_detail", Value: []byte(errorDetail)},
-        kafka.Header{Key: "original_topic", Value: []byte(c.reader.Config().Topic)},
-        kafka.Header{Key: "failed_at", Value: []byte(time.Now().Format(time.RFC3339))},
-    )
-
-    // Write to DLQ
-    err := c.dlqWriter.WriteMessages(context.Background(), msg)
-    if err != nil {
-        log.Printf("⚠️ Failed to send message to DLQ: %v", err)
-    } else {
-        log.Printf("📝 Message sent to DLQ: %s", errorType)
-    }
-}
-
-// Stop gracefully shuts down the consumer
-func (c *Consumer) Stop() {
-    close(c.stopChan)
-    c.wg.Wait()
-    
-    if err := c.reader.Close(); err != nil {
-        log.Printf("⚠️ Error closing Kafka reader: %v", err)
-    }
-    
-    if err := c.dlqWriter.Close(); err != nil {
-        log.Printf("⚠️ Error closing DLQ writer: %v", err)
-    }
-    
-    log.Println("✅ Kafka consumer stopped")
+	c.queue = newKeyQueue()
+	c.slots = make(chan struct{}, c.workers*inFlightPerWorker)
+	var workers sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				d, ok := c.queue.next()
+				if !ok {
+					return
+				}
+				c.processMessage(d)
+			}
+		}()
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case <-c.fetchCtx.Done():
+				c.logger.Info("consumer shutting down")
+				// Let the workers finish what was fetched; Stop cancels ctx once its deadline passes
+				stop := context.AfterFunc(c.ctx, c.queue.close)
+				c.queue.wait()
+				stop()
+				c.queue.close()
+				workers.Wait()
+				for _, d := range c.queue.drain() {
+					c.abandon(d)
+				}
+				return
+			default:
+				c.fetchMessage()
+			}
+		}
+	}()
+	c.logger.Info("consumer started", slog.Int("workers", c.workers))
+}
+
+// fetchMessage fetches a single message from Kafka and queues it behind the earlier
+// messages of its key
+func (c *Consumer) fetchMessage() {
+	// Wait for room rather than letting the backlog behind retrying keys grow without bound
+	select {
+	case c.slots <- struct{}{}:
+	case <-c.fetchCtx.Done():
+		return
+	}
+
+	msg, err := c.reader.FetchMessage(c.fetchCtx)
+	if err != nil {
+		<-c.slots
+		if c.fetchCtx.Err() != nil {
+			return
+		}
+		c.logger.Warn("failed to fetch message", logging.Err(err))
+		sleep(c.fetchCtx, 1*time.Second) // Wait before retrying
+		return
+	}
+
+	c.logger.Debug("message received",
+		slog.Int(logging.KeyPartition, msg.Partition),
+		slog.Int64(logging.KeyOffset, msg.Offset),
+		slog.String(logging.KeyKey, string(msg.Key)),
+	)
+
+	// Track before queueing so the partition's commit order follows fetch order
+	c.queue.push(&delivery{entry: c.offsets.track(msg), backoff: c.retryConfig.InitialBackoff})
+}
+
+// processMessage runs a queued message until it is finished or a handler attempt failed.
+// A failed attempt with retries left is scheduled again after its backoff, so the worker
+// moves on to other keys in the meantime. A finished message has its partition's offsets
+// committed as far as they are contiguous with completed messages.
+func (c *Consumer) processMessage(d *delivery) {
+	if d.ctx == nil {
+		c.startMessage(d)
+	}
+
+	switch c.handleMessage(d) {
+	case stepRetry:
+		c.queue.retryAfter(d, d.backoff)
+		d.backoff = c.nextBackoff(d.backoff)
+	case stepCommit:
+		c.finishMessage(d, true)
+	case stepAbandon:
+		c.finishMessage(d, false)
+	}
+}
+
+// startMessage opens the span a message is processed in and derives its logger
+func (c *Consumer) startMessage(d *delivery) {
+	msg := d.entry.msg
+	// Continue the producer's trace from the W3C trace context in the message headers
+	ctx := otel.GetTextMapPropagator().Extract(c.ctx, headerCarrier{headers: &msg.Headers})
+	ctx, d.span = tracing.Tracer().Start(ctx, c.topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(c.topic),
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(msg.Partition)),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		),
+	)
+
+	// Every log line about this message, including the handlers', carries its coordinates
+	logger := logging.WithTraceID(ctx, c.logger.With(
+		slog.Int(logging.KeyPartition, msg.Partition),
+		slog.Int64(logging.KeyOffset, msg.Offset),
+		slog.String(logging.KeyKey, string(msg.Key)),
+	))
+	d.ctx = logging.WithLogger(ctx, logger)
+}
+
+// finishMessage removes a message from the queue and, if commit is set, commits every
+// offset of its partition that is now contiguous with completed messages
+func (c *Consumer) finishMessage(d *delivery, commit bool) {
+	defer d.span.End()
+	c.queue.done(d)
+	defer func() { <-c.slots }()
+
+	if !commit {
+		d.span.SetStatus(codes.Error, "message left uncommitted")
+		// Leave the offset uncommitted, which also holds back later offsets of the
+		// partition, so the message is redelivered after a restart
+		return
+	}
+
+	msg, ok := c.offsets.complete(d.entry)
+	if !ok {
+		// An earlier message of the partition is still in flight; whoever completes it commits this offset too
+		return
+	}
+
+	c.commitMu.Lock()
+	defer c.commitMu.Unlock()
+	if !c.offsets.isAhead(msg) {
+		// The same or a newer offset of the partition was committed already
+		return
+	}
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(d.ctx), commitTimeout)
+	defer cancel()
+	if err := c.reader.CommitMessages(commitCtx, msg); err != nil {
+		// The messages will be redelivered; handlers and the ledger make that harmless
+		c.logger.Warn("failed to commit offset",
+			slog.Int(logging.KeyPartition, msg.Partition),
+			slog.Int64(logging.KeyOffset, msg.Offset),
+			logging.Err(err),
+		)
+		return
+	}
+	c.offsets.committed(msg)
+}
+
+// abandon ends a message that was still waiting for a retry when the consumer stopped;
+// its offset stays uncommitted so it is redelivered after a restart
+func (c *Consumer) abandon(d *delivery) {
+	if d.ctx == nil {
+		// Never started, so there is nothing to report
+		return
+	}
+	logging.FromContext(d.ctx).Warn("event abandoned on shutdown", logging.Err(d.lastErr))
+	metrics.EventsProcessed.WithLabelValues(d.event.Type, metrics.OutcomeAbandoned).Inc()
+	d.span.SetStatus(codes.Error, "message left uncommitted")
+	d.span.End()
+}
+
+// handleMessage makes the next handler attempt for a message, parsing it and checking
+// the ledger before the first one. The message may be committed once the event was
+// applied, skipped as a duplicate or parked in the DLQ.
+func (c *Consumer) handleMessage(d *delivery) step {
+	if d.handler == nil {
+		var event Event
+		if err := json.Unmarshal(d.entry.msg.Value, &event); err != nil {
+			logging.FromContext(d.ctx).Error("failed to parse message", logging.Err(err))
+			if !c.sendToDLQ(d.ctx, d.entry.msg, "parse_error", err.Error()) {
+				return stepAbandon
+			}
+			return stepCommit
+		}
+		d.event = event
+
+		logger := logging.FromContext(d.ctx).With(
+			slog.String(logging.KeyEventType, event.Type),
+			slog.String(logging.KeyEventID, event.ID),
+		)
+		d.ctx = logging.WithLogger(d.ctx, logger)
+
+		d.span.SetName(c.topic + " process " + event.Type)
+		d.span.SetAttributes(attribute.String("event.type", event.Type), attribute.String("event.id", event.ID))
+
+		// Skip events that were already projected before a redelivery
+		if c.alreadyProcessed(d.ctx, event) {
+			logger.Info("skipping already processed event")
+			metrics.EventsProcessed.WithLabelValues(event.Type, metrics.OutcomeDuplicate).Inc()
+			return stepCommit
+		}
+
+		handler, exists := c.handlers[event.Type]
+		if !exists {
+			logger.Error("no handler registered for event type")
+			if !c.sendToDLQ(d.ctx, d.entry.msg, "no_handler", "No handler registered for this event type") {
+				return stepAbandon
+			}
+			return stepCommit
+		}
+		d.handler = handler
+	}
+
+	ctx, event := d.ctx, d.event
+	logger := logging.FromContext(ctx)
+	err := c.attempt(d)
+	if err == nil {
+		c.markProcessed(ctx, event)
+		metrics.EventsProcessed.WithLabelValues(event.Type, metrics.OutcomeApplied).Inc()
+		logger.Info("event processed")
+		return stepCommit
+	}
+
+	if ctx.Err() != nil {
+		// Interrupted by Stop rather than failed; redeliver it instead of parking it in the DLQ
+		logger.Warn("event abandoned on shutdown", logging.Err(err))
+		metrics.EventsProcessed.WithLabelValues(event.Type, metrics.OutcomeAbandoned).Inc()
+		return stepAbandon
+	}
+
+	if d.attempt <= c.retryConfig.MaxRetries {
+		logger.Warn("retrying event",
+			slog.Int("attempt", d.attempt),
+			slog.Int("max_retries", c.retryConfig.MaxRetries),
+			slog.Duration("backoff", d.backoff),
+			logging.Err(err),
+		)
+		metrics.EventRetries.WithLabelValues(event.Type).Inc()
+		return stepRetry
+	}
+
+	logger.Error("failed to process event after retries", logging.Err(err))
+	if !c.sendToDLQ(ctx, d.entry.msg, "processing_error", err.Error()) {
+		metrics.EventsProcessed.WithLabelValues(event.Type, metrics.OutcomeAbandoned).Inc()
+		return stepAbandon
+	}
+	metrics.EventsProcessed.WithLabelValues(event.Type, metrics.OutcomeDeadLettered).Inc()
+	return stepCommit
+}
+
+// alreadyProcessed reports whether the ledger has seen this event. Lookup failures are
+// treated as unseen since the handlers are idempotent.
+func (c *Consumer) alreadyProcessed(ctx context.Context, event Event) bool {
+	if c.ledger == nil || event.ID == "" {
+		return false
+	}
+	processed, err := c.ledger.IsProcessed(ctx, event.ID)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to check event ledger", logging.Err(err))
+		return false
+	}
+	return processed
+}
+
+// markProcessed records a successfully handled event in the ledger
+func (c *Consumer) markProcessed(ctx context.Context, event Event) {
+	if c.ledger == nil || event.ID == "" {
+		return
+	}
+	if err := c.ledger.MarkProcessed(ctx, event.ID, event.Type); err != nil {
+		logging.FromContext(ctx).Warn("failed to record event in ledger", logging.Err(err))
+	}
+}
+
+// attempt calls the handler of a message once, counting the attempt
+func (c *Consumer) attempt(d *delivery) error {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(d.ctx, "handle "+d.event.Type,
+		trace.WithAttributes(attribute.Int("event.attempt", d.attempt)))
+	d.attempt++
+	err := d.handler(ctx, d.event.Data)
+	tracing.End(span, err)
+	metrics.ObserveEventHandler(d.event.Type, start, err)
+	d.lastErr = err
+	return err
+}
+
+// nextBackoff grows a retry backoff by the backoff factor, up to the maximum
+func (c *Consumer) nextBackoff(backoff time.Duration) time.Duration {
+	backoff = time.Duration(float64(backoff) * c.retryConfig.BackoffFactor)
+	if backoff > c.retryConfig.MaxBackoff {
+		backoff = c.retryConfig.MaxBackoff
+	}
+	return backoff
+}
+
+// sendToDLQ sends a failed message to the Dead Letter Queue, retrying until the write is
+// acknowledged. It returns false only if ctx is cancelled first.
+func (c *Consumer) sendToDLQ(ctx context.Context, msg kafka.Message, errorType, errorDetail string) bool {
+	msg.Topic = c.topic + "-dlq"
+	// Add error information to message headers
+	msg.Headers = append(msg.Headers,
+		kafka.Header{Key: "error_type", Value: []byte(errorType)},
+		kafka.Header{Key: "error_detail", Value: []byte(errorDetail)},
+		kafka.Header{Key: "original_topic", Value: []byte(c.topic)},
+		kafka.Header{Key: "failed_at", Value: []byte(time.Now().Format(time.RFC3339))},
+	)
+
+	// Write to DLQ; moving on without an ack would commit past a message stored nowhere
+	backoff := c.retryConfig.InitialBackoff
+	for {
+		err := c.dlqWriter.WriteMessages(ctx, msg)
+		if err == nil {
+			logging.FromContext(ctx).Warn("message sent to DLQ", slog.String("error_type", errorType))
+			metrics.DLQMessages.WithLabelValues(errorType).Inc()
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		logging.FromContext(ctx).Error("failed to send message to DLQ",
+			slog.String("error_type", errorType),
+			slog.Duration("backoff", backoff),
+			logging.Err(err),
+		)
+
+		if sleep(ctx, backoff) != nil {
+			return false
+		}
+		backoff = c.nextBackoff(backoff)
+	}
+}
+
+// Stop gracefully shuts down the consumer. It stops fetching and waits for the workers to
+// finish the messages already fetched, including their retries and DLQ writes. If ctx is
+// done first, it cancels the handlers, backoffs and DLQ writes still running and returns
+// the context's error; messages they did not finish stay uncommitted and are redelivered.
+func (c *Consumer) Stop(ctx context.Context) error {
+	c.stopFetching()
+	drained := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		c.logger.Warn("consumer shutdown deadline passed; abandoning unfinished messages")
+		c.cancel()
+		<-drained
+		err = ctx.Err()
+	}
+	c.cancel()
+
+	if err := c.reader.Close(); err != nil {
+		c.logger.Warn("failed to close reader", logging.Err(err))
+	}
+
+	if err := c.dlqWriter.Close(); err != nil {
+		c.logger.Warn("failed to close DLQ writer", logging.Err(err))
+	}
+
+	c.logger.Info("consumer stopped")
+	return err
+}
+
+// sleep waits for d or until ctx is cancelled, returning the context's error in that case
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
@@ -0,0 +1,339 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeReader hands out queued messages and records commits
+type fakeReader struct {
+	messages chan kafka.Message
+
+	mu      sync.Mutex
+	commits []kafka.Message
+}
+
+func newFakeReader(msgs ...kafka.Message) *fakeReader {
+	r := &fakeReader{messages: make(chan kafka.Message, len(msgs)+16)}
+	for _, msg := range msgs {
+		r.messages <- msg
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commits = append(r.commits, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Stats() kafka.ReaderStats { return kafka.ReaderStats{} }
+
+func (r *fakeReader) Close() error { return nil }
+
+// committedOffsets returns the committed offsets in commit order
+func (r *fakeReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offsets := make([]int64, 0, len(r.commits))
+	for _, msg := range r.commits {
+		offsets = append(offsets, msg.Offset)
+	}
+	return offsets
+}
+
+// fakeWriter fails the first failures writes, or every write when failures is negative,
+// and records the acknowledged ones
+type fakeWriter struct {
+	failures int
+
+	mu       sync.Mutex
+	attempts int
+	written  []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.attempts++
+	if w.failures < 0 || w.attempts <= w.failures {
+		return errors.New("broker unavailable")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func (w *fakeWriter) state() (attempts int, written []kafka.Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.attempts, append([]kafka.Message(nil), w.written...)
+}
+
+var testRetries = RetryConfig{
+	MaxRetries:     2,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	BackoffFactor:  2,
+}
+
+func newTestConsumer(t *testing.T, reader messageReader, dlq messageWriter, retries RetryConfig) *Consumer {
+	t.Helper()
+	c := newConsumer(reader, dlq, "events", retries)
+	c.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return c
+}
+
+func eventMessage(t *testing.T, partition int, offset int64, key, eventType string) kafka.Message {
+	t.Helper()
+	value, err := json.Marshal(Event{Type: eventType, Data: map[string]interface{}{"key": key}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Topic: "events", Partition: partition, Offset: offset, Key: []byte(key), Value: value}
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConsumerCommitsAfterHandlerSuccess(t *testing.T) {
+	reader := newFakeReader(eventMessage(t, 0, 0, "p1", "ProductCreated"))
+	c := newTestConsumer(t, reader, &fakeWriter{}, testRetries)
+
+	var handled atomic.Bool
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		if len(reader.committedOffsets()) > 0 {
+			t.Error("offset committed before the handler returned")
+		}
+		handled.Store(true)
+		return nil
+	})
+	c.Start()
+	defer c.Stop(context.Background())
+
+	waitFor(t, "commit", func() bool { return len(reader.committedOffsets()) == 1 })
+	if !handled.Load() {
+		t.Fatal("handler was not called")
+	}
+	if got := reader.committedOffsets(); got[0] != 0 {
+		t.Fatalf("committed offsets %v, want [0]", got)
+	}
+}
+
+func TestConsumerDoesNotCommitWhenHandlerAndDLQFail(t *testing.T) {
+	reader := newFakeReader(eventMessage(t, 0, 0, "p1", "ProductCreated"))
+	dlq := &fakeWriter{failures: -1}
+	c := newTestConsumer(t, reader, dlq, testRetries)
+
+	var calls atomic.Int32
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		calls.Add(1)
+		return errors.New("mongo unavailable")
+	})
+	c.Start()
+
+	waitFor(t, "repeated DLQ writes", func() bool {
+		attempts, _ := dlq.state()
+		return attempts >= 3
+	})
+	// The DLQ write keeps retrying until the shutdown deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop returned %v, want the deadline error", err)
+	}
+
+	if got := calls.Load(); got != int32(testRetries.MaxRetries+1) {
+		t.Errorf("handler called %d times, want %d", got, testRetries.MaxRetries+1)
+	}
+	if got := reader.committedOffsets(); len(got) != 0 {
+		t.Fatalf("committed offsets %v, want none", got)
+	}
+}
+
+func TestConsumerCommitsAfterDLQAck(t *testing.T) {
+	reader := newFakeReader(eventMessage(t, 0, 0, "p1", "ProductCreated"))
+	dlq := &fakeWriter{failures: 2}
+	c := newTestConsumer(t, reader, dlq, testRetries)
+
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		return errors.New("mongo unavailable")
+	})
+	c.Start()
+	defer c.Stop(context.Background())
+
+	waitFor(t, "commit", func() bool { return len(reader.committedOffsets()) == 1 })
+	attempts, written := dlq.state()
+	if attempts != 3 || len(written) != 1 {
+		t.Fatalf("DLQ got %d attempts and %d acknowledged messages, want 3 and 1", attempts, len(written))
+	}
+	if written[0].Topic != "events-dlq" {
+		t.Errorf("DLQ topic %q, want events-dlq", written[0].Topic)
+	}
+	headers := map[string]string{}
+	for _, h := range written[0].Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	if headers["error_type"] != "processing_error" || headers["original_topic"] != "events" {
+		t.Errorf("DLQ headers %v, want error_type processing_error and original_topic events", headers)
+	}
+}
+
+func TestConsumerStopMidRetryDoesNotCommit(t *testing.T) {
+	reader := newFakeReader(eventMessage(t, 0, 0, "p1", "ProductCreated"))
+	dlq := &fakeWriter{}
+	retries := testRetries
+	retries.InitialBackoff = time.Hour
+	retries.MaxBackoff = time.Hour
+	c := newTestConsumer(t, reader, dlq, retries)
+
+	var calls atomic.Int32
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		calls.Add(1)
+		return errors.New("mongo unavailable")
+	})
+	c.Start()
+
+	waitFor(t, "first attempt", func() bool { return calls.Load() == 1 })
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error)
+	go func() {
+		stopped <- c.Stop(ctx)
+	}()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Stop returned %v, want the deadline error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not interrupt the retry backoff at its deadline")
+	}
+
+	if got := reader.committedOffsets(); len(got) != 0 {
+		t.Fatalf("committed offsets %v, want none", got)
+	}
+	if attempts, _ := dlq.state(); attempts != 0 {
+		t.Fatalf("DLQ got %d writes, want none", attempts)
+	}
+}
+
+func TestConsumerRetryDoesNotHoldBackOtherKeys(t *testing.T) {
+	reader := newFakeReader(
+		eventMessage(t, 0, 0, "failing", "ProductCreated"),
+		eventMessage(t, 0, 1, "other", "ProductCreated"),
+		eventMessage(t, 0, 2, "failing", "ProductCreated"),
+	)
+	retries := testRetries
+	retries.MaxRetries = 1000
+	retries.InitialBackoff = 10 * time.Millisecond
+	retries.MaxBackoff = 10 * time.Millisecond
+	// A single worker handles every key
+	c := newTestConsumer(t, reader, &fakeWriter{}, retries)
+
+	var broken atomic.Bool
+	broken.Store(true)
+	var mu sync.Mutex
+	var applied []string
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		key := data.(map[string]interface{})["key"].(string)
+		if key == "failing" && broken.Load() {
+			return errors.New("mongo unavailable")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		applied = append(applied, key)
+		return nil
+	})
+	appliedKeys := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), applied...)
+	}
+	c.Start()
+	defer c.Stop(context.Background())
+
+	waitFor(t, "the other key", func() bool { return len(appliedKeys()) == 1 })
+	if got := appliedKeys(); got[0] != "other" {
+		t.Fatalf("applied %v while the failing key retries, want [other]", got)
+	}
+	if got := reader.committedOffsets(); len(got) != 0 {
+		t.Fatalf("committed %v while offset 0 is retrying, want nothing", got)
+	}
+
+	broken.Store(false)
+	waitFor(t, "commit of offset 2", func() bool {
+		got := reader.committedOffsets()
+		return len(got) > 0 && got[len(got)-1] == 2
+	})
+	if got := appliedKeys(); !slices.Equal(got, []string{"other", "failing", "failing"}) {
+		t.Fatalf("applied %v, want the failing key's messages after its retry in order", got)
+	}
+}
+
+func TestConsumerStopDrainsInFlightMessages(t *testing.T) {
+	reader := newFakeReader(eventMessage(t, 0, 0, "p1", "ProductCreated"))
+	c := newTestConsumer(t, reader, &fakeWriter{}, testRetries)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	c.Start()
+	<-started
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- c.Stop(context.Background())
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop returned %v while a handler was running", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop returned %v, want nil", err)
+	}
+	if got := reader.committedOffsets(); !slices.Equal(got, []int64{0}) {
+		t.Fatalf("committed offsets %v, want [0]", got)
+	}
+}
@@ -1,37 +1,51 @@
 package messaging
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"query-service/cache"
-	db "query-service/db"
+	"query-service/config"
+	"query-service/logging"
+	"query-service/metrics"
 	"query-service/models"
+	"query-service/repository"
+	"query-service/search"
+	"strconv"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 type Event struct {
+	ID   string      `json:"eventId"`
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
 }
 
+// EventHandlers projects events into the injected stores
+type EventHandlers struct {
+	Products  repository.ProductRepository
+	Orders    repository.OrderRepository
+	Customers repository.CustomerRepository
+	Cache     cache.Cache
+	Search    search.SearchIndex
+	TTL       config.CacheConfig
+}
+
 // RegisterEventHandlers registers all event handlers with the consumer
-func RegisterEventHandlers(consumer *Consumer) {
-	consumer.RegisterHandler("ProductCreated", handleProductCreated)
-	consumer.RegisterHandler("ProductUpdated", handleProductUpdated)
-	consumer.RegisterHandler("InventoryChanged", handleInventoryChanged)
-	consumer.RegisterHandler("OrderCreated", handleOrderCreated)
-	consumer.RegisterHandler("OrderStatusChanged", handleOrderStatusChanged)
-
-	log.Println("✅ Event handlers registered")
+func RegisterEventHandlers(consumer *Consumer, h *EventHandlers) {
+	consumer.RegisterHandler("ProductCreated", h.handleProductCreated)
+	consumer.RegisterHandler("ProductUpdated", h.handleProductUpdated)
+	consumer.RegisterHandler("InventoryChanged", h.handleInventoryChanged)
+	consumer.RegisterHandler("OrderCreated", h.handleOrderCreated)
+	consumer.RegisterHandler("OrderStatusChanged", h.handleOrderStatusChanged)
+
+	consumer.logger.Info("event handlers registered")
 }
 
 // handleProductCreated processes ProductCreated events
-func handleProductCreated(ctx context.Context, data interface{}) error {
+func (h *EventHandlers) handleProductCreated(ctx context.Context, data interface{}) error {
 	product := models.Product{}
 	if err := mapToStruct(data, &product); err != nil {
 		return fmt.Errorf("invalid product data: %w", err)
@@ -41,45 +55,36 @@ func handleProductCreated(ctx context.Context, data interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	// Step 1: Add to MongoDB
-	_, err := db.ProductCollection.InsertOne(ctx, product)
-	if err != nil {
-		return fmt.Errorf("failed to insert product into MongoDB: %w", err)
+	// Step 1: Upsert into MongoDB so redeliveries are harmless
+	err := h.Products.Upsert(ctx, product)
+	if errors.Is(err, repository.ErrStale) {
+		return dropStale(ctx, "ProductCreated", product.ProductID, product.Version)
 	}
-
-	// Step 2: Add to Elasticsearch
-	productJSON, err := json.Marshal(product)
 	if err != nil {
-		return fmt.Errorf("failed to marshal product for Elasticsearch: %w", err)
+		return fmt.Errorf("failed to upsert product into MongoDB: %w", err)
 	}
 
-	res, err := db.ElasticsearchClient.Index(
-		"products",
-		bytes.NewReader(productJSON),
-		db.ElasticsearchClient.Index.WithContext(ctx),
-		db.ElasticsearchClient.Index.WithDocumentID(product.ProductID),
-	)
-	if err != nil {
+	// Step 2: Add to Elasticsearch
+	if err := h.Search.IndexProduct(ctx, product); err != nil {
 		return fmt.Errorf("failed to index product in Elasticsearch: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		return fmt.Errorf("Elasticsearch error: %s", res.String())
-	}
-
-	// Step 3: Invalidate Redis cache
-	if err := cache.RedisClient.Del(ctx, "products:category:"+product.Category.ID).Err(); err != nil {
-		log.Printf("⚠️ Warning: Failed to invalidate Redis cache: %v", err)
-		// Continue despite cache invalidation failure
-	}
-
-	log.Printf("✅ Product created: %s - %s", product.ProductID, product.Name)
+	// Step 3: Invalidate Redis caches
+	h.invalidate(ctx, invalidation{
+		tags:  []string{cache.ProductTag(product.ProductID)},
+		keys:  []string{cache.InventoryKey(product.ProductID)},
+		lists: categoryLists(product),
+	})
+
+	logging.FromContext(ctx).Info("product created",
+		slog.String(logging.KeyProductID, product.ProductID),
+		slog.String("name", product.Name),
+	)
 	return nil
 }
 
 // handleProductUpdated processes ProductUpdated events
-func handleProductUpdated(ctx context.Context, data interface{}) error {
+func (h *EventHandlers) handleProductUpdated(ctx context.Context, data interface{}) error {
 	product := models.Product{}
 	if err := mapToStruct(data, &product); err != nil {
 		return fmt.Errorf("invalid product data: %w", err)
@@ -89,55 +94,80 @@ func handleProductUpdated(ctx context.Context, data interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	// Step 1: Update MongoDB
-	_, err := db.ProductCollection.UpdateOne(
-		ctx,
-		bson.M{"productId": product.ProductID},
-		bson.M{"$set": product},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to update product in MongoDB: %w", err)
+	// Step 1: Look up the current category so its lists are invalidated if the product moves
+	lists := categoryLists(product)
+	previous, err := h.Products.FindByID(ctx, product.ProductID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to load product from MongoDB: %w", err)
+	}
+	if err == nil && (previous.Category.ID != product.Category.ID ||
+		previous.Category.ParentCategory.ID != product.Category.ParentCategory.ID) {
+		lists = append(lists, categoryLists(previous)...)
 	}
 
-	// Step 2: Update Elasticsearch
-	productJSON, err := json.Marshal(product)
+	// Step 2: Update MongoDB unless a newer version is already stored
+	err = h.Products.Update(ctx, product)
+	if errors.Is(err, repository.ErrStale) {
+		return dropStale(ctx, "ProductUpdated", product.ProductID, product.Version)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal product for Elasticsearch: %w", err)
+		return fmt.Errorf("failed to update product in MongoDB: %w", err)
 	}
 
-	res, err := db.ElasticsearchClient.Index(
-		"products",
-		bytes.NewReader(productJSON),
-		db.ElasticsearchClient.Index.WithContext(ctx),
-		db.ElasticsearchClient.Index.WithDocumentID(product.ProductID),
-	)
-	if err != nil {
+	// Step 3: Update Elasticsearch
+	if err := h.Search.IndexProduct(ctx, product); err != nil {
 		return fmt.Errorf("failed to update product in Elasticsearch: %w", err)
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		return fmt.Errorf("Elasticsearch error: %s", res.String())
-	}
+	// Step 4: Invalidate every cached entry embedding the product, including other categories' pages
+	h.invalidate(ctx, invalidation{
+		tags:  []string{cache.ProductTag(product.ProductID)},
+		keys:  []string{cache.InventoryKey(product.ProductID)},
+		lists: lists,
+	})
 
-	// Step 3: Invalidate Redis caches
-	pipe := cache.RedisClient.Pipeline()
-	pipe.Del(ctx, "product:"+product.ProductID)
-	pipe.Del(ctx, "products:category:"+product.Category.ID)
-	if _, err := pipe.Exec(ctx); err != nil {
-		log.Printf("⚠️ Warning: Failed to invalidate Redis caches: %v", err)
-		// Continue despite cache invalidation failure
+	logging.FromContext(ctx).Info("product updated",
+		slog.String(logging.KeyProductID, product.ProductID),
+		slog.String("name", product.Name),
+	)
+	return nil
+}
+
+// categoryLists are the lists a product appears in: its category's, and its parent
+// category's, whose subcategory listing includes it
+func categoryLists(product models.Product) []string {
+	lists := []string{cache.CategoryListKey(product.Category.ID)}
+	if parentID := product.Category.ParentCategory.ID; parentID != "" {
+		lists = append(lists, cache.CategoryListKey(parentID))
 	}
+	return lists
+}
 
-	log.Printf("✅ Product updated: %s - %s", product.ProductID, product.Name)
-	return nil
+// InvalidateProducts drops every cached entry embedding the products, as an update of
+// each would. A reindex calls it for every batch so Redis is rebuilt from MongoDB along
+// with the search index.
+func (h *EventHandlers) InvalidateProducts(ctx context.Context, products []models.Product) {
+	var inv invalidation
+	seen := make(map[string]bool)
+	for _, product := range products {
+		inv.tags = append(inv.tags, cache.ProductTag(product.ProductID))
+		inv.keys = append(inv.keys, cache.InventoryKey(product.ProductID))
+		for _, list := range categoryLists(product) {
+			if !seen[list] {
+				seen[list] = true
+				inv.lists = append(inv.lists, list)
+			}
+		}
+	}
+	h.invalidate(ctx, inv)
 }
 
 // handleInventoryChanged processes InventoryChanged events
-func handleInventoryChanged(ctx context.Context, data interface{}) error {
+func (h *EventHandlers) handleInventoryChanged(ctx context.Context, data interface{}) error {
 	inventoryChange := struct {
 		ProductID string `json:"productId"`
 		Quantity  int    `json:"quantity"`
+		Version   int64  `json:"version"`
 	}{}
 	if err := mapToStruct(data, &inventoryChange); err != nil {
 		return fmt.Errorf("invalid inventory data: %w", err)
@@ -148,51 +178,79 @@ func handleInventoryChanged(ctx context.Context, data interface{}) error {
 	defer cancel()
 
 	// Step 1: Update MongoDB
-	result, err := db.ProductCollection.UpdateOne(
-		ctx,
-		bson.M{"productId": inventoryChange.ProductID},
-		bson.M{"$set": bson.M{"currentInventory": inventoryChange.Quantity}},
-	)
+	product, err := h.Products.SetInventory(ctx, inventoryChange.ProductID, inventoryChange.Quantity, inventoryChange.Version)
+	if errors.Is(err, repository.ErrStale) {
+		return dropStale(ctx, "InventoryChanged", inventoryChange.ProductID, inventoryChange.Version)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("product not found: %s", inventoryChange.ProductID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update inventory in MongoDB: %w", err)
 	}
 
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("product not found: %s", inventoryChange.ProductID)
+	// Step 2: Update Elasticsearch, whose in-stock filter and hits read the stock level
+	if err := h.Search.IndexProduct(ctx, product); err != nil {
+		return fmt.Errorf("failed to update inventory in Elasticsearch: %w", err)
 	}
 
-	// Step 2: Update Redis cache
-	err = cache.RedisClient.Set(
+	// Step 3: Invalidate cached entries embedding the product. The category lists are
+	// bumped too, since the product may enter in-stock pages or move in inventory order.
+	h.invalidate(ctx, invalidation{
+		tags:  []string{cache.ProductTag(product.ProductID)},
+		lists: categoryLists(product),
+	})
+
+	// Step 4: Update Redis cache
+	err = h.Cache.Set(
 		ctx,
-		"inventory:"+inventoryChange.ProductID,
-		inventoryChange.Quantity,
-		10*time.Minute,
-	).Err()
+		cache.InventoryKey(inventoryChange.ProductID),
+		[]byte(strconv.Itoa(inventoryChange.Quantity)),
+		h.TTL.InventoryTTL.Duration,
+	)
 	if err != nil {
-		log.Printf("⚠️ Warning: Failed to update Redis cache: %v", err)
+		logging.FromContext(ctx).Warn("failed to update cache",
+			slog.String(logging.KeyCacheKey, cache.InventoryKey(inventoryChange.ProductID)),
+			logging.Err(err),
+		)
 		// Continue despite cache update failure
 	}
 
-	log.Printf("✅ Inventory updated for product %s: %d units",
-		inventoryChange.ProductID, inventoryChange.Quantity)
+	logging.FromContext(ctx).Info("inventory updated",
+		slog.String(logging.KeyProductID, inventoryChange.ProductID),
+		slog.Int("quantity", inventoryChange.Quantity),
+	)
 	return nil
 }
 
+// customerVersion is the customer's aggregate version an order event may carry next to
+// the order's own, guarding the customer's order history
+type customerVersion struct {
+	Version int64 `json:"customerVersion"`
+}
+
 // handleOrderCreated processes OrderCreated events
-func handleOrderCreated(ctx context.Context, data interface{}) error {
+func (h *EventHandlers) handleOrderCreated(ctx context.Context, data interface{}) error {
 	order := models.Order{}
 	if err := mapToStruct(data, &order); err != nil {
 		return fmt.Errorf("invalid order data: %w", err)
 	}
+	customer := customerVersion{}
+	if err := mapToStruct(data, &customer); err != nil {
+		return fmt.Errorf("invalid order data: %w", err)
+	}
 
 	// Transaction context with timeout
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	// Step 1: Add to MongoDB
-	_, err := db.OrderCollection.InsertOne(ctx, order)
+	// Step 1: Upsert into MongoDB so redeliveries are harmless
+	err := h.Orders.Upsert(ctx, order)
+	if errors.Is(err, repository.ErrStale) {
+		return dropStale(ctx, "OrderCreated", order.OrderID, order.Version)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to insert order into MongoDB: %w", err)
+		return fmt.Errorf("failed to upsert order into MongoDB: %w", err)
 	}
 
 	// Step 2: Update customer order history
@@ -204,31 +262,34 @@ func handleOrderCreated(ctx context.Context, data interface{}) error {
 		Status:      order.Status,
 	}
 
-	_, err = db.CustomerCollection.UpdateOne(
-		ctx,
-		bson.M{"customerId": order.CustomerID},
-		bson.M{"$push": bson.M{"orderHistory": orderHistoryEntry}},
-	)
-	if err != nil {
+	err = h.Customers.AppendOrderHistory(ctx, order.CustomerID, orderHistoryEntry, customer.Version)
+	if errors.Is(err, repository.ErrStale) {
+		// The customer already reflects a newer event; the order itself is applied
+		_ = dropStale(ctx, "OrderCreated", order.CustomerID, customer.Version)
+	} else if err != nil {
 		return fmt.Errorf("failed to update customer order history: %w", err)
 	}
 
-	// Step 3: Invalidate Redis customer orders cache
-	cacheKey := "customer:" + order.CustomerID + ":orders"
-	if err := cache.RedisClient.Del(ctx, cacheKey).Err(); err != nil {
-		log.Printf("⚠️ Warning: Failed to invalidate Redis cache: %v", err)
-		// Continue despite cache invalidation failure
-	}
+	// Step 3: Invalidate the cached customer and its order pages
+	h.invalidate(ctx, invalidation{
+		tags:  []string{cache.CustomerTag(order.CustomerID)},
+		lists: []string{cache.CustomerOrdersListKey(order.CustomerID)},
+	})
 
-	log.Printf("✅ Order created: %s for customer %s", order.OrderID, order.CustomerID)
+	logging.FromContext(ctx).Info("order created",
+		slog.String(logging.KeyOrderID, order.OrderID),
+		slog.String(logging.KeyCustomerID, order.CustomerID),
+	)
 	return nil
 }
 
 // handleOrderStatusChanged processes OrderStatusChanged events
-func handleOrderStatusChanged(ctx context.Context, data interface{}) error {
+func (h *EventHandlers) handleOrderStatusChanged(ctx context.Context, data interface{}) error {
 	statusChange := struct {
-		OrderID string `json:"orderId"`
-		Status  string `json:"status"`
+		OrderID         string `json:"orderId"`
+		Status          string `json:"status"`
+		Version         int64  `json:"version"`
+		CustomerVersion int64  `json:"customerVersion"`
 	}{}
 	if err := mapToStruct(data, &statusChange); err != nil {
 		return fmt.Errorf("invalid order status data: %w", err)
@@ -239,53 +300,80 @@ func handleOrderStatusChanged(ctx context.Context, data interface{}) error {
 	defer cancel()
 
 	// Step 1: Get order to retrieve customer ID
-	var order models.Order
-	err := db.OrderCollection.FindOne(ctx, bson.M{"orderId": statusChange.OrderID}).Decode(&order)
+	order, err := h.Orders.FindByID(ctx, statusChange.OrderID)
 	if err != nil {
 		return fmt.Errorf("failed to find order: %w", err)
 	}
 
-	// Step 2: Update order status in MongoDB
-	_, err = db.OrderCollection.UpdateOne(
-		ctx,
-		bson.M{"orderId": statusChange.OrderID},
-		bson.M{"$set": bson.M{
-			"status":  statusChange.Status,
-			"updated": time.Now(),
-		}},
-	)
+	// Step 2: Update order status in MongoDB unless a newer version is already stored
+	err = h.Orders.UpdateStatus(ctx, statusChange.OrderID, statusChange.Status, statusChange.Version, time.Now())
+	if errors.Is(err, repository.ErrStale) {
+		return dropStale(ctx, "OrderStatusChanged", statusChange.OrderID, statusChange.Version)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update order status in MongoDB: %w", err)
 	}
 
 	// Step 3: Update order status in customer order history
-	_, err = db.CustomerCollection.UpdateOne(
-		ctx,
-		bson.M{
-			"customerId":          order.CustomerID,
-			"orderHistory.orderId": statusChange.OrderID,
-		},
-		bson.M{"$set": bson.M{
-			"orderHistory.$.status": statusChange.Status,
-		}},
-	)
-	if err != nil {
+	err = h.Customers.UpdateOrderHistoryStatus(ctx, order.CustomerID, statusChange.OrderID, statusChange.Status,
+		statusChange.CustomerVersion)
+	if errors.Is(err, repository.ErrStale) {
+		// The customer already reflects a newer event; the order itself is applied
+		_ = dropStale(ctx, "OrderStatusChanged", order.CustomerID, statusChange.CustomerVersion)
+	} else if err != nil {
 		return fmt.Errorf("failed to update order status in customer history: %w", err)
 	}
 
-	// Step 4: Invalidate Redis caches
-	pipe := cache.RedisClient.Pipeline()
-	pipe.Del(ctx, "order:"+statusChange.OrderID)
-	pipe.Del(ctx, "customer:"+order.CustomerID+":orders")
-	if _, err := pipe.Exec(ctx); err != nil {
-		log.Printf("⚠️ Warning: Failed to invalidate Redis caches: %v", err)
-		// Continue despite cache invalidation failure
-	}
+	// Step 4: Invalidate the order, the customer's history and every order page containing it
+	h.invalidate(ctx, invalidation{
+		tags: []string{cache.OrderTag(statusChange.OrderID)},
+	})
+
+	logging.FromContext(ctx).Info("order status updated",
+		slog.String(logging.KeyOrderID, statusChange.OrderID),
+		slog.String("status", statusChange.Status),
+	)
+	return nil
+}
 
-	log.Printf("✅ Order status updated: %s -> %s", statusChange.OrderID, statusChange.Status)
+// dropStale records an out-of-order event that was skipped because a newer version is projected
+func dropStale(ctx context.Context, eventType, aggregateID string, version int64) error {
+	metrics.StaleEvents.WithLabelValues(eventType).Inc()
+	logging.FromContext(ctx).Info("dropping stale event: version is older than the stored one",
+		slog.String("aggregate_id", aggregateID),
+		slog.Int64("version", version),
+	)
 	return nil
 }
 
+// invalidation lists the cache entries an event makes stale.
+// See cache/keys.go for which entries each event clears.
+type invalidation struct {
+	tags  []string // tags whose entries are dropped
+	keys  []string // untagged keys to delete
+	lists []string // version-stamped lists to bump
+}
+
+// invalidate applies an invalidation, logging failures instead of failing the event
+func (h *EventHandlers) invalidate(ctx context.Context, inv invalidation) {
+	if len(inv.tags) > 0 {
+		if err := h.Cache.InvalidateTags(ctx, inv.tags...); err != nil {
+			logging.FromContext(ctx).Warn("failed to invalidate cache tags", slog.Any("tags", inv.tags), logging.Err(err))
+			// Continue despite cache invalidation failure
+		}
+	}
+	if len(inv.keys) > 0 {
+		if err := h.Cache.Del(ctx, inv.keys...); err != nil {
+			logging.FromContext(ctx).Warn("failed to invalidate cache keys", slog.Any("keys", inv.keys), logging.Err(err))
+		}
+	}
+	for _, list := range inv.lists {
+		if err := cache.InvalidateList(ctx, h.Cache, list); err != nil {
+			logging.FromContext(ctx).Warn("failed to invalidate cached list", slog.String(logging.KeyCacheKey, list), logging.Err(err))
+		}
+	}
+}
+
 func mapToStruct(data interface{}, target interface{}) error {
 	bytes, err := json.Marshal(data)
 	if err != nil {
@@ -0,0 +1,143 @@
+package messaging
+
+import (
+	"context"
+	"query-service/cache"
+	"query-service/config"
+	"query-service/models"
+	"query-service/repository"
+	"query-service/search"
+	"testing"
+	"time"
+)
+
+// newTestHandlers projects events into memory stores
+func newTestHandlers() *EventHandlers {
+	return &EventHandlers{
+		Products:  repository.NewMemoryProductRepository(),
+		Orders:    repository.NewMemoryOrderRepository(),
+		Customers: repository.NewMemoryCustomerRepository(),
+		Cache:     cache.NewMemoryCache(),
+		Search:    search.NewMemoryIndex(),
+		TTL:       config.CacheConfig{InventoryTTL: config.Duration{Duration: time.Minute}},
+	}
+}
+
+// inStockIDs returns the IDs of the products an inStock=true search finds
+func inStockIDs(t *testing.T, h *EventHandlers) []string {
+	t.Helper()
+	result, err := h.Search.Search(context.Background(), search.Query{InStock: true, Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.Product.ProductID)
+	}
+	return ids
+}
+
+func TestInventoryChangedUpdatesInStockSearch(t *testing.T) {
+	h := newTestHandlers()
+	ctx := context.Background()
+
+	product := models.Product{ProductID: "p1", Name: "Phone", Category: models.Category{ID: "c1"}, Version: 1}
+	if err := h.handleProductCreated(ctx, product); err != nil {
+		t.Fatal(err)
+	}
+	if ids := inStockIDs(t, h); len(ids) != 0 {
+		t.Fatalf("in-stock search found %v before any stock arrived, want nothing", ids)
+	}
+
+	steps := []struct {
+		quantity int
+		version  int64
+		want     int
+	}{
+		{quantity: 5, version: 2, want: 1},
+		{quantity: 0, version: 3, want: 0},
+		{quantity: 2, version: 4, want: 1},
+	}
+	for _, step := range steps {
+		change := map[string]interface{}{"productId": "p1", "quantity": step.quantity, "version": step.version}
+		if err := h.handleInventoryChanged(ctx, change); err != nil {
+			t.Fatal(err)
+		}
+		if ids := inStockIDs(t, h); len(ids) != step.want {
+			t.Errorf("after stock %d at version %d: in-stock search found %v, want %d products",
+				step.quantity, step.version, ids, step.want)
+		}
+	}
+
+	result, err := h.Search.Search(ctx, search.Query{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].Product.CurrentInventory != 2 || result.Hits[0].Product.Version != 4 {
+		t.Errorf("indexed product %+v, want inventory 2 at version 4", result.Hits)
+	}
+}
+
+func TestOrderEventsSkipOlderCustomerVersions(t *testing.T) {
+	h := newTestHandlers()
+	h.Customers = repository.NewMemoryCustomerRepository(models.Customer{CustomerID: "c1"})
+	ctx := context.Background()
+
+	events := []struct {
+		handle func(context.Context, interface{}) error
+		data   map[string]interface{}
+	}{
+		{h.handleOrderCreated, map[string]interface{}{
+			"orderId": "o1", "customerId": "c1", "status": "created", "version": 1, "customerVersion": 1}},
+		{h.handleOrderStatusChanged, map[string]interface{}{
+			"orderId": "o1", "status": "shipped", "version": 3, "customerVersion": 3}},
+		// Delayed: the order write is unversioned, but the customer already holds version 3
+		{h.handleOrderStatusChanged, map[string]interface{}{
+			"orderId": "o1", "status": "paid", "customerVersion": 2}},
+	}
+	for _, event := range events {
+		if err := event.handle(ctx, event.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	customer, err := h.Customers.FindByID(ctx, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer.Version != 3 {
+		t.Errorf("customer version %d, want 3", customer.Version)
+	}
+	if len(customer.OrderHistory) != 1 || customer.OrderHistory[0].Status != "shipped" {
+		t.Errorf("order history %+v, want o1 shipped", customer.OrderHistory)
+	}
+}
+
+func TestUnversionedEventKeepsStoredVersion(t *testing.T) {
+	h := newTestHandlers()
+	ctx := context.Background()
+
+	events := []struct {
+		handle func(context.Context, interface{}) error
+		data   models.Product
+	}{
+		{h.handleProductCreated, models.Product{ProductID: "p1", Name: "v5", Version: 5}},
+		// An event without a version is applied but must not reset the stored version
+		{h.handleProductUpdated, models.Product{ProductID: "p1", Name: "unversioned"}},
+		// A replayed older event must still be dropped
+		{h.handleProductUpdated, models.Product{ProductID: "p1", Name: "v3", Version: 3}},
+	}
+	for _, event := range events {
+		if err := event.handle(ctx, event.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	product, err := h.Products.FindByID(ctx, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "unversioned" || product.Version != 5 {
+		t.Errorf("stored %q at version %d, want \"unversioned\" at version 5", product.Name, product.Version)
+	}
+}
@@ -1,9 +1,9 @@
 package messaging
 
 import (
-	"log"
+	"log/slog"
 )
 
 func InitKafka() {
-	log.Println("✅ Kafka initialization completed!")
+	slog.Info("Kafka initialization completed")
 }
\ No newline at end of file
@@ -0,0 +1,150 @@
+package messaging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// orderKey identifies messages that must be handled one at a time in fetch order: those
+// sharing a key, or the keyless messages of one partition
+type orderKey struct {
+	key       string
+	partition int // -1 for keyed messages
+}
+
+func orderKeyOf(msg kafka.Message) orderKey {
+	if len(msg.Key) > 0 {
+		return orderKey{key: string(msg.Key), partition: -1}
+	}
+	return orderKey{partition: msg.Partition}
+}
+
+// keyQueue hands queued messages to the workers one key at a time. A key is ready when
+// its oldest message may run; a message waiting for a retry keeps its key out of the
+// ready list until the backoff passes, so it holds back only the messages behind it.
+type keyQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond               // signalled when a key becomes ready
+	empty  *sync.Cond               // broadcast when the last queued message finishes
+	keys   map[orderKey][]*delivery // queued messages of each key, oldest first
+	ready  []orderKey               // keys whose oldest message may run, in the order they became ready
+	timers map[*delivery]*time.Timer
+	closed bool
+}
+
+func newKeyQueue() *keyQueue {
+	q := &keyQueue{
+		keys:   make(map[orderKey][]*delivery),
+		timers: make(map[*delivery]*time.Timer),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	q.empty = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a fetched message behind the earlier messages of its key
+func (q *keyQueue) push(d *delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k := orderKeyOf(d.entry.msg)
+	q.keys[k] = append(q.keys[k], d)
+	if len(q.keys[k]) == 1 {
+		q.markReady(k)
+	}
+}
+
+// next waits for a ready key and returns its oldest message; it returns false once the
+// queue is closed
+func (q *keyQueue) next() (*delivery, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.ready) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+	k := q.ready[0]
+	q.ready = q.ready[1:]
+	return q.keys[k][0], true
+}
+
+// done removes a finished message, making the next message of its key ready
+func (q *keyQueue) done(d *delivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	k := orderKeyOf(d.entry.msg)
+	q.keys[k][0] = nil
+	q.keys[k] = q.keys[k][1:]
+	if len(q.keys[k]) == 0 {
+		delete(q.keys, k)
+		if len(q.keys) == 0 {
+			q.empty.Broadcast()
+		}
+		return
+	}
+	q.markReady(k)
+}
+
+// retryAfter makes a message's key ready again once backoff has passed; until then the
+// workers handle other keys
+func (q *keyQueue) retryAfter(d *delivery, backoff time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.timers[d] = time.AfterFunc(backoff, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		delete(q.timers, d)
+		if !q.closed {
+			q.markReady(orderKeyOf(d.entry.msg))
+		}
+	})
+}
+
+// close wakes the waiting workers and cancels pending retries; messages still queued
+// stay there for drain
+func (q *keyQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for d, timer := range q.timers {
+		timer.Stop()
+		delete(q.timers, d)
+	}
+	q.cond.Broadcast()
+	q.empty.Broadcast()
+}
+
+// wait blocks until every queued message finished or the queue is closed
+func (q *keyQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.keys) > 0 && !q.closed {
+		q.empty.Wait()
+	}
+}
+
+// drain empties the queue and returns the messages that never finished; it is called
+// once the workers returned
+func (q *keyQueue) drain() []*delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var left []*delivery
+	for k, deliveries := range q.keys {
+		left = append(left, deliveries...)
+		delete(q.keys, k)
+	}
+	q.ready = nil
+	return left
+}
+
+// markReady must be called with q.mu held
+func (q *keyQueue) markReady(k orderKey) {
+	q.ready = append(q.ready, k)
+	q.cond.Signal()
+}
@@ -0,0 +1,67 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Lag returns how many messages of the topic the consumer group has not committed yet,
+// summed over all partitions. Partitions without a committed offset count from their
+// first retained message.
+func (c *Consumer) Lag(ctx context.Context) (int64, error) {
+	meta, err := c.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{c.topic}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get metadata for %s: %w", c.topic, err)
+	}
+	if len(meta.Topics) == 0 || meta.Topics[0].Error != nil {
+		return 0, fmt.Errorf("topic %s not found", c.topic)
+	}
+
+	partitions := make([]int, len(meta.Topics[0].Partitions))
+	requests := make([]kafka.OffsetRequest, 0, 2*len(partitions))
+	for i, p := range meta.Topics[0].Partitions {
+		partitions[i] = p.ID
+		requests = append(requests, kafka.FirstOffsetOf(p.ID), kafka.LastOffsetOf(p.ID))
+	}
+
+	committed, err := c.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: c.groupID,
+		Topics:  map[string][]int{c.topic: partitions},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return 0, fmt.Errorf("failed to fetch committed offsets: %w", committed.Error)
+	}
+
+	offsets, err := c.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{c.topic: requests},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	committedByPartition := make(map[int]int64, len(partitions))
+	for _, p := range committed.Topics[c.topic] {
+		committedByPartition[p.Partition] = p.CommittedOffset
+	}
+
+	var lag int64
+	for _, p := range offsets.Topics[c.topic] {
+		if p.Error != nil {
+			return 0, fmt.Errorf("failed to list offsets of partition %d: %w", p.Partition, p.Error)
+		}
+		position, ok := committedByPartition[p.Partition]
+		if !ok || position < p.FirstOffset {
+			// Nothing committed yet, or the committed offset was already deleted by retention
+			position = p.FirstOffset
+		}
+		if p.LastOffset > position {
+			lag += p.LastOffset - position
+		}
+	}
+	return lag, nil
+}
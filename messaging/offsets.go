@@ -0,0 +1,82 @@
+package messaging
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker keeps the in-flight messages of each partition in fetch order so that
+// offsets are committed strictly in order even though workers finish out of order
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending   []*pendingMessage // in-flight messages in fetch order
+	committed int64             // highest offset committed, -1 if none
+}
+
+type pendingMessage struct {
+	msg  kafka.Message
+	done bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track registers a fetched message; it must be called in fetch order
+func (t *offsetTracker) track(msg kafka.Message) *pendingMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{committed: -1}
+		t.partitions[msg.Partition] = p
+	}
+	entry := &pendingMessage{msg: msg}
+	p.pending = append(p.pending, entry)
+	return entry
+}
+
+// complete marks a message as handled and returns the highest message of its partition
+// whose offset, together with every earlier one, may now be committed
+func (t *offsetTracker) complete(entry *pendingMessage) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry.done = true
+	p := t.partitions[entry.msg.Partition]
+
+	var last *pendingMessage
+	for len(p.pending) > 0 && p.pending[0].done {
+		last = p.pending[0]
+		p.pending[0] = nil
+		p.pending = p.pending[1:]
+	}
+	if last == nil {
+		return kafka.Message{}, false
+	}
+	return last.msg, true
+}
+
+// isAhead reports whether msg is past the highest offset committed for its partition.
+// Committing anything else would move the group offset backwards, such as after a slow
+// commit lost the race to a newer one, or when a rebalance redelivered older offsets.
+func (t *offsetTracker) isAhead(msg kafka.Message) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return msg.Offset > t.partitions[msg.Partition].committed
+}
+
+// committed records that msg's offset was committed
+func (t *offsetTracker) committed(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if p := t.partitions[msg.Partition]; msg.Offset > p.committed {
+		p.committed = msg.Offset
+	}
+}
@@ -0,0 +1,123 @@
+package messaging
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTrackerCommitsContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	entries := make([]*pendingMessage, 4)
+	for i := range entries {
+		entries[i] = tracker.track(kafka.Message{Partition: 0, Offset: int64(i)})
+	}
+	other := tracker.track(kafka.Message{Partition: 1, Offset: 0})
+
+	for _, i := range []int{1, 3} {
+		if _, ok := tracker.complete(entries[i]); ok {
+			t.Fatalf("offset %d committable while offset 0 is in flight", i)
+		}
+	}
+	if msg, ok := tracker.complete(other); !ok || msg.Partition != 1 || msg.Offset != 0 {
+		t.Fatalf("partition 1 got (%d, %v), want offset 0 committable", msg.Offset, ok)
+	}
+	msg, ok := tracker.complete(entries[0])
+	if !ok || msg.Offset != 1 {
+		t.Fatalf("got (%d, %v), want offset 1 committable", msg.Offset, ok)
+	}
+	msg, ok = tracker.complete(entries[2])
+	if !ok || msg.Offset != 3 {
+		t.Fatalf("got (%d, %v), want offset 3 committable", msg.Offset, ok)
+	}
+}
+
+func TestOffsetTrackerNeverGoesBackwards(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.track(kafka.Message{Partition: 0, Offset: 5})
+	tracker.committed(kafka.Message{Partition: 0, Offset: 5})
+
+	for _, offset := range []int64{3, 5} {
+		if tracker.isAhead(kafka.Message{Partition: 0, Offset: offset}) {
+			t.Errorf("offset %d is ahead of committed offset 5", offset)
+		}
+	}
+	if !tracker.isAhead(kafka.Message{Partition: 0, Offset: 6}) {
+		t.Error("offset 6 is not ahead of committed offset 5")
+	}
+	// A slow commit finishing late must not lower the recorded offset
+	tracker.committed(kafka.Message{Partition: 0, Offset: 4})
+	if tracker.isAhead(kafka.Message{Partition: 0, Offset: 5}) {
+		t.Error("recorded offset moved backwards")
+	}
+}
+
+func TestConsumerCommitsInOrderAcrossWorkers(t *testing.T) {
+	reader := newFakeReader()
+	c := newTestConsumer(t, reader, &fakeWriter{}, testRetries)
+	c.SetWorkers(2)
+
+	// Offset 0 occupies one worker and blocks; the other worker handles the later offsets
+	for i, key := range []string{"slow", "fast1", "fast2", "fast3"} {
+		reader.messages <- eventMessage(t, 0, int64(i), key, "ProductCreated")
+	}
+
+	release := make(chan struct{})
+	var fastDone atomic.Int32
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		if data.(map[string]interface{})["key"] == "slow" {
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		fastDone.Add(1)
+		return nil
+	})
+	c.Start()
+	defer c.Stop(context.Background())
+
+	waitFor(t, "later messages", func() bool { return fastDone.Load() == 3 })
+	if got := reader.committedOffsets(); len(got) != 0 {
+		t.Fatalf("committed %v while offset 0 is in flight, want nothing", got)
+	}
+
+	close(release)
+	waitFor(t, "commit", func() bool { return len(reader.committedOffsets()) > 0 })
+	if got := reader.committedOffsets(); !slices.Equal(got, []int64{3}) {
+		t.Fatalf("committed offsets %v, want [3]", got)
+	}
+}
+
+func TestConsumerSkipsCommitOfRedeliveredOffsets(t *testing.T) {
+	// After a rebalance the partition is fetched again from an older offset
+	reader := newFakeReader(
+		eventMessage(t, 0, 0, "p1", "ProductCreated"),
+		eventMessage(t, 0, 1, "p1", "ProductCreated"),
+	)
+	c := newTestConsumer(t, reader, &fakeWriter{}, testRetries)
+
+	var handled atomic.Int32
+	c.RegisterHandler("ProductCreated", func(ctx context.Context, data interface{}) error {
+		handled.Add(1)
+		return nil
+	})
+	c.Start()
+
+	waitFor(t, "first commits", func() bool { return len(reader.committedOffsets()) == 2 })
+	reader.messages <- eventMessage(t, 0, 0, "p1", "ProductCreated")
+	waitFor(t, "redelivery", func() bool { return handled.Load() == 3 })
+	// Stop waits for the worker to finish with the redelivered message
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reader.committedOffsets(); !slices.Equal(got, []int64{0, 1}) {
+		t.Fatalf("committed offsets %v, want [0 1]", got)
+	}
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaReaderCollector exports kafka.Reader statistics. Reader.Stats resets its counters
+// on every call, so the collector accumulates them into running totals.
+type KafkaReaderCollector struct {
+	stats func() kafka.ReaderStats
+
+	mu     sync.Mutex
+	totals map[*prometheus.Desc]int64
+
+	dials, fetches, messages, bytes, rebalances, timeouts, errors *prometheus.Desc
+	lag, offset, queueLength, queueCapacity                       *prometheus.Desc
+}
+
+// NewKafkaReaderCollector creates a collector reading from stats, typically Reader.Stats
+func NewKafkaReaderCollector(stats func() kafka.ReaderStats) *KafkaReaderCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("kafka_reader_"+name, help, []string{"topic"}, nil)
+	}
+	return &KafkaReaderCollector{
+		stats:         stats,
+		totals:        make(map[*prometheus.Desc]int64),
+		dials:         desc("dials_total", "Connections opened to brokers."),
+		fetches:       desc("fetches_total", "Fetch requests sent to brokers."),
+		messages:      desc("messages_total", "Messages read."),
+		bytes:         desc("message_bytes_total", "Bytes of messages read."),
+		rebalances:    desc("rebalances_total", "Consumer group rebalances."),
+		timeouts:      desc("timeouts_total", "Fetches that timed out."),
+		errors:        desc("errors_total", "Reader errors."),
+		lag:           desc("lag", "Messages behind the high watermark of the last fetched partition."),
+		offset:        desc("offset", "Offset of the last fetched message."),
+		queueLength:   desc("queue_length", "Messages fetched but not yet consumed."),
+		queueCapacity: desc("queue_capacity", "Capacity of the internal fetch queue."),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (k *KafkaReaderCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		k.dials, k.fetches, k.messages, k.bytes, k.rebalances, k.timeouts, k.errors,
+		k.lag, k.offset, k.queueLength, k.queueCapacity,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector
+func (k *KafkaReaderCollector) Collect(ch chan<- prometheus.Metric) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	s := k.stats()
+	for d, delta := range map[*prometheus.Desc]int64{
+		k.dials:      s.Dials,
+		k.fetches:    s.Fetches,
+		k.messages:   s.Messages,
+		k.bytes:      s.Bytes,
+		k.rebalances: s.Rebalances,
+		k.timeouts:   s.Timeouts,
+		k.errors:     s.Errors,
+	} {
+		k.totals[d] += delta
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(k.totals[d]), s.Topic)
+	}
+	ch <- prometheus.MustNewConstMetric(k.lag, prometheus.GaugeValue, float64(s.Lag), s.Topic)
+	ch <- prometheus.MustNewConstMetric(k.offset, prometheus.GaugeValue, float64(s.Offset), s.Topic)
+	ch <- prometheus.MustNewConstMetric(k.queueLength, prometheus.GaugeValue, float64(s.QueueLength), s.Topic)
+	ch <- prometheus.MustNewConstMetric(k.queueCapacity, prometheus.GaugeValue, float64(s.QueueCapacity), s.Topic)
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Collectors are registered with the default Prometheus registry and served by /metrics.
+// Label values are kept low-cardinality: routes are path templates and cache keys are
+// reduced to their prefix, never raw IDs.
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "Cache lookups by key prefix and result (hit, miss or error).",
+	}, []string{"prefix", "result"})
+
+	EventHandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "event_handler_duration_seconds",
+		Help:    "Duration of a single event handler attempt by event type and outcome (success or error).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event_type", "outcome"})
+
+	EventsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_processed_total",
+		Help: "Consumed events by event type and final outcome (applied, duplicate, dead_lettered or abandoned).",
+	}, []string{"event_type", "outcome"})
+
+	EventRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "event_retries_total",
+		Help: "Handler retries by event type.",
+	}, []string{"event_type"})
+
+	StaleEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "stale_events_total",
+		Help: "Events dropped because a newer version was already applied, by event type.",
+	}, []string{"event_type"})
+
+	DLQMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dlq_messages_total",
+		Help: "Messages acknowledged by the dead letter queue by error type.",
+	}, []string{"error_type"})
+)
+
+// Outcomes recorded in EventsProcessed
+const (
+	OutcomeApplied      = "applied"
+	OutcomeDuplicate    = "duplicate"
+	OutcomeDeadLettered = "dead_lettered"
+	OutcomeAbandoned    = "abandoned"
+)
+
+// Cache lookup results recorded in CacheRequests
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// GinMiddleware records request counts and latencies per route template
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// ObserveEventHandler records one handler attempt
+func ObserveEventHandler(eventType string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	EventHandlerDuration.WithLabelValues(eventType, outcome).Observe(time.Since(start).Seconds())
+}
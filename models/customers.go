@@ -34,6 +34,7 @@ type Customer struct {
     Phone        string              `bson:"phone" json:"phone"`
     Addresses    []CustomerAddress   `bson:"addresses" json:"addresses"`
     OrderHistory []OrderHistoryEntry `bson:"orderHistory" json:"orderHistory"`
+    Version      int64               `bson:"version,omitempty" json:"version"` // Aggregate version of the last applied event; 0 is not written
     Created      time.Time           `bson:"created" json:"created"`
     Updated      time.Time           `bson:"updated" json:"updated"`
 }
@@ -35,6 +35,7 @@ type Order struct {
     TotalAmount    float64            `bson:"totalAmount" json:"totalAmount"`
     Items          []OrderItem        `bson:"items" json:"items"`
     ShippingAddress ShippingAddress   `bson:"shippingAddress" json:"shippingAddress"`
+    Version        int64              `bson:"version,omitempty" json:"version"` // Aggregate version of the last applied event; 0 is not written
     Created        time.Time          `bson:"created" json:"created"`
     Updated        time.Time          `bson:"updated" json:"updated"`
 }
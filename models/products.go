@@ -33,6 +33,7 @@ type Product struct {
     CurrentInventory int                `bson:"currentInventory" json:"currentInventory"`
     Images           []string           `bson:"images" json:"images"`
     Attributes       []Attribute        `bson:"attributes" json:"attributes"`
+    Version          int64              `bson:"version,omitempty" json:"version"` // Aggregate version of the last applied event; 0 is not written
     Created          time.Time          `bson:"created" json:"created"`
     Updated          time.Time          `bson:"updated" json:"updated"`
 }
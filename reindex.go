@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os/signal"
+	"query-service/cache"
+	"query-service/config"
+	"query-service/db"
+	"query-service/logging"
+	"query-service/messaging"
+	"query-service/repository"
+	"query-service/search"
+	"syscall"
+)
+
+// runReindex implements the reindex subcommand: it rebuilds the product search index and
+// the cached product entries from MongoDB, then returns. Interrupting it keeps the
+// checkpoint, so running it again resumes where it stopped.
+func runReindex(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	fresh := flags.Bool("fresh", false, "discard an unfinished reindex instead of resuming it")
+	flags.IntVar(&cfg.Reindex.BatchSize, "batch-size", cfg.Reindex.BatchSize, "products per _bulk request")
+	flags.IntVar(&cfg.Reindex.Concurrency, "concurrency", cfg.Reindex.Concurrency, "_bulk requests in flight at once")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db.InitMongo(cfg.Mongo)
+	defer db.CloseMongo(context.Background())
+	cache.InitRedis(cfg.Redis)
+	defer cache.CloseRedis()
+	db.InitElasticsearch(cfg.Elasticsearch)
+	defer db.CloseElasticsearch()
+
+	products := repository.NewMongoProductRepository(db.ProductCollection)
+	checkpoints := repository.NewMongoCheckpointStore(db.ReindexCheckpointCollection)
+	indices := search.NewIndexManager(search.NewElasticsearchIndex(db.ElasticsearchClient, search.ProductsAlias),
+		products, checkpoints, cfg.Reindex)
+	handlers := &messaging.EventHandlers{Cache: cache.NewRedisCache(cache.RedisClient), TTL: cfg.Cache}
+	indices.SetBatchHook(handlers.InvalidateProducts)
+
+	if _, err := indices.Ensure(ctx); err != nil {
+		return err
+	}
+	status, err := indices.Reindex(ctx, *fresh)
+	if err != nil {
+		return err
+	}
+	slog.Info("search index rebuilt",
+		slog.String(logging.KeyIndex, status.Index),
+		slog.Int64("indexed", status.Indexed),
+		slog.Bool("resumed", status.Resumed),
+	)
+	return nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"cmp"
+	"query-service/models"
+	"strings"
+	"time"
+)
+
+// SortField names a stored field a list can be ordered by
+type SortField string
+
+const (
+	SortCreated   SortField = "created"
+	SortPrice     SortField = "price"
+	SortName      SortField = "name"
+	SortInventory SortField = "currentInventory"
+)
+
+// Sort orders a list by Field, then by ID in the same direction. The zero value orders by
+// creation time, oldest first.
+type Sort struct {
+	Field      SortField
+	Descending bool
+}
+
+func (s Sort) field() SortField {
+	if s.Field == "" {
+		return SortCreated
+	}
+	return s.Field
+}
+
+// Position is a place in a sorted list: the value of the sort field and the ID that
+// breaks ties between equal values
+type Position struct {
+	Value interface{}
+	ID    string
+}
+
+// ListQuery selects one page of a sorted list. Pages are addressed either by offset
+// (Skip) or by keyset: with After set the page starts right after that position, with
+// Before set it ends right before it. Results are always returned in list order.
+type ListQuery struct {
+	Sort   Sort
+	Skip   int64
+	Limit  int64
+	After  *Position
+	Before *Position
+}
+
+// ProductFilter selects the products of a category listing
+type ProductFilter struct {
+	CategoryID string
+	// IncludeSubcategories also matches products whose parent category is CategoryID
+	IncludeSubcategories bool
+	MinPrice             *float64
+	MaxPrice             *float64
+	// InStock keeps only products with inventory left
+	InStock bool
+	// Attributes keeps only products carrying every one of these name/value pairs
+	Attributes []models.Attribute
+}
+
+// Matches reports whether product passes the filter
+func (f ProductFilter) Matches(product models.Product) bool {
+	if product.Category.ID != f.CategoryID &&
+		!(f.IncludeSubcategories && product.Category.ParentCategory.ID == f.CategoryID) {
+		return false
+	}
+	if f.MinPrice != nil && product.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && product.Price > *f.MaxPrice {
+		return false
+	}
+	if f.InStock && product.CurrentInventory <= 0 {
+		return false
+	}
+	for _, want := range f.Attributes {
+		if !hasAttribute(product, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAttribute(product models.Product, want models.Attribute) bool {
+	for _, attr := range product.Attributes {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductPosition returns a function giving a product's place in a list ordered by sort
+func ProductPosition(sort Sort) func(models.Product) Position {
+	return func(product models.Product) Position {
+		var value interface{}
+		switch sort.field() {
+		case SortPrice:
+			value = product.Price
+		case SortName:
+			value = product.Name
+		case SortInventory:
+			value = product.CurrentInventory
+		default:
+			value = product.Created
+		}
+		return Position{Value: value, ID: product.ProductID}
+	}
+}
+
+// OrderPosition is an order's place in a customer's order list, which is ordered by creation time
+func OrderPosition(order models.Order) Position {
+	return Position{Value: order.Created, ID: order.OrderID}
+}
+
+// comparePositions orders positions by value, then by ID
+func comparePositions(a, b Position) int {
+	if c := compareValues(a.Value, b.Value); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// compareValues compares two sort values of the same type
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case int:
+		return cmp.Compare(a, b.(int))
+	case string:
+		return cmp.Compare(a, b.(string))
+	default:
+		return 0
+	}
+}
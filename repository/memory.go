@@ -0,0 +1,430 @@
+package repository
+
+import (
+	"context"
+	"query-service/models"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryProductRepository keeps products in memory, in insertion order
+type MemoryProductRepository struct {
+	mu       sync.RWMutex
+	products []models.Product
+}
+
+// NewMemoryProductRepository creates an in-memory product repository seeded with products
+func NewMemoryProductRepository(products ...models.Product) *MemoryProductRepository {
+	return &MemoryProductRepository{products: products}
+}
+
+func (r *MemoryProductRepository) FindByID(ctx context.Context, productID string) (models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.indexOf(productID); i >= 0 {
+		return r.products[i], nil
+	}
+	return models.Product{}, ErrNotFound
+}
+
+func (r *MemoryProductRepository) FindByCategory(ctx context.Context, filter ProductFilter, query ListQuery) ([]models.Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []models.Product
+	for _, product := range r.products {
+		if filter.Matches(product) {
+			matched = append(matched, product)
+		}
+	}
+	return paginate(matched, ProductPosition(query.Sort), query), nil
+}
+
+func (r *MemoryProductRepository) Upsert(ctx context.Context, product models.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.indexOf(product.ProductID); i >= 0 {
+		if isStale(r.products[i].Version, product.Version) {
+			return ErrStale
+		}
+		product.Version = keptVersion(r.products[i].Version, product.Version)
+		r.products[i] = product
+		return nil
+	}
+	r.products = append(r.products, product)
+	return nil
+}
+
+func (r *MemoryProductRepository) Update(ctx context.Context, product models.Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.indexOf(product.ProductID); i >= 0 {
+		if isStale(r.products[i].Version, product.Version) {
+			return ErrStale
+		}
+		product.Version = keptVersion(r.products[i].Version, product.Version)
+		r.products[i] = product
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) SetInventory(ctx context.Context, productID string, quantity int, version int64) (models.Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(productID)
+	if i < 0 {
+		return models.Product{}, ErrNotFound
+	}
+	if isStale(r.products[i].Version, version) {
+		return models.Product{}, ErrStale
+	}
+	r.products[i].CurrentInventory = quantity
+	if version > 0 {
+		r.products[i].Version = version
+	}
+	return r.products[i], nil
+}
+
+func (r *MemoryProductRepository) Scan(ctx context.Context, afterID string, fn func(models.Product) error) error {
+	r.mu.RLock()
+	products := slices.Clone(r.products)
+	r.mu.RUnlock()
+
+	slices.SortFunc(products, func(a, b models.Product) int { return strings.Compare(a.ProductID, b.ProductID) })
+	for _, product := range products {
+		if product.ProductID <= afterID {
+			continue
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) Count(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int64(len(r.products)), nil
+}
+
+func (r *MemoryProductRepository) indexOf(productID string) int {
+	for i, product := range r.products {
+		if product.ProductID == productID {
+			return i
+		}
+	}
+	return -1
+}
+
+// MemoryOrderRepository keeps orders in memory, in insertion order
+type MemoryOrderRepository struct {
+	mu     sync.RWMutex
+	orders []models.Order
+}
+
+// NewMemoryOrderRepository creates an in-memory order repository seeded with orders
+func NewMemoryOrderRepository(orders ...models.Order) *MemoryOrderRepository {
+	return &MemoryOrderRepository{orders: orders}
+}
+
+func (r *MemoryOrderRepository) FindByID(ctx context.Context, orderID string) (models.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.indexOf(orderID); i >= 0 {
+		return r.orders[i], nil
+	}
+	return models.Order{}, ErrNotFound
+}
+
+func (r *MemoryOrderRepository) FindByCustomer(ctx context.Context, customerID string, query ListQuery) ([]models.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matched []models.Order
+	for _, order := range r.orders {
+		if order.CustomerID == customerID {
+			matched = append(matched, order)
+		}
+	}
+	return paginate(matched, OrderPosition, query), nil
+}
+
+func (r *MemoryOrderRepository) Upsert(ctx context.Context, order models.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.indexOf(order.OrderID); i >= 0 {
+		if isStale(r.orders[i].Version, order.Version) {
+			return ErrStale
+		}
+		order.Version = keptVersion(r.orders[i].Version, order.Version)
+		r.orders[i] = order
+		return nil
+	}
+	r.orders = append(r.orders, order)
+	return nil
+}
+
+func (r *MemoryOrderRepository) UpdateStatus(ctx context.Context, orderID, status string, version int64, updated time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.indexOf(orderID); i >= 0 {
+		if isStale(r.orders[i].Version, version) {
+			return ErrStale
+		}
+		r.orders[i].Status = status
+		r.orders[i].Updated = updated
+		if version > 0 {
+			r.orders[i].Version = version
+		}
+	}
+	return nil
+}
+
+func (r *MemoryOrderRepository) indexOf(orderID string) int {
+	for i, order := range r.orders {
+		if order.OrderID == orderID {
+			return i
+		}
+	}
+	return -1
+}
+
+// MemoryCustomerRepository keeps customers in memory, in insertion order
+type MemoryCustomerRepository struct {
+	mu        sync.RWMutex
+	customers []models.Customer
+}
+
+// NewMemoryCustomerRepository creates an in-memory customer repository seeded with customers
+func NewMemoryCustomerRepository(customers ...models.Customer) *MemoryCustomerRepository {
+	return &MemoryCustomerRepository{customers: customers}
+}
+
+func (r *MemoryCustomerRepository) FindByID(ctx context.Context, customerID string) (models.Customer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := r.indexOf(customerID); i >= 0 {
+		customer := r.customers[i]
+		customer.OrderHistory = append([]models.OrderHistoryEntry(nil), customer.OrderHistory...)
+		return customer, nil
+	}
+	return models.Customer{}, ErrNotFound
+}
+
+func (r *MemoryCustomerRepository) AppendOrderHistory(ctx context.Context, customerID string, entry models.OrderHistoryEntry, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(customerID)
+	if i < 0 {
+		return nil
+	}
+	if isStale(r.customers[i].Version, version) {
+		return ErrStale
+	}
+	for _, existing := range r.customers[i].OrderHistory {
+		if existing.OrderID == entry.OrderID {
+			return nil
+		}
+	}
+	r.customers[i].OrderHistory = append(r.customers[i].OrderHistory, entry)
+	if version > 0 {
+		r.customers[i].Version = version
+	}
+	return nil
+}
+
+func (r *MemoryCustomerRepository) UpdateOrderHistoryStatus(ctx context.Context, customerID, orderID, status string, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(customerID)
+	if i < 0 {
+		return nil
+	}
+	if isStale(r.customers[i].Version, version) {
+		return ErrStale
+	}
+	for j := range r.customers[i].OrderHistory {
+		if r.customers[i].OrderHistory[j].OrderID == orderID {
+			r.customers[i].OrderHistory[j].Status = status
+			if version > 0 {
+				r.customers[i].Version = version
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func (r *MemoryCustomerRepository) indexOf(customerID string) int {
+	for i, customer := range r.customers {
+		if customer.CustomerID == customerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// MemoryEventLedger keeps processed event IDs in memory
+type MemoryEventLedger struct {
+	mu        sync.RWMutex
+	processed map[string]string
+}
+
+// NewMemoryEventLedger creates an empty in-memory event ledger
+func NewMemoryEventLedger() *MemoryEventLedger {
+	return &MemoryEventLedger{processed: make(map[string]string)}
+}
+
+func (l *MemoryEventLedger) IsProcessed(ctx context.Context, eventID string) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.processed[eventID]
+	return ok, nil
+}
+
+func (l *MemoryEventLedger) MarkProcessed(ctx context.Context, eventID, eventType string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.processed[eventID] = eventType
+	return nil
+}
+
+// MemoryCheckpointStore keeps reindex checkpoints and locks in memory
+type MemoryCheckpointStore struct {
+	mu          sync.RWMutex
+	checkpoints map[string]ReindexCheckpoint
+	locks       map[string]memoryLock
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemoryCheckpointStore creates an empty in-memory checkpoint store
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{
+		checkpoints: make(map[string]ReindexCheckpoint),
+		locks:       make(map[string]memoryLock),
+	}
+}
+
+func (s *MemoryCheckpointStore) Load(ctx context.Context, name string) (ReindexCheckpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	checkpoint, ok := s.checkpoints[name]
+	if !ok {
+		return ReindexCheckpoint{}, ErrNotFound
+	}
+	return checkpoint, nil
+}
+
+func (s *MemoryCheckpointStore) Save(ctx context.Context, name string, checkpoint ReindexCheckpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[name] = checkpoint
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.checkpoints, name)
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Lock(ctx context.Context, name, owner string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := s.locks[name]; ok && lock.owner != owner && now.Before(lock.expires) {
+		return ErrLocked
+	}
+	s.locks[name] = memoryLock{owner: owner, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Unlock(ctx context.Context, name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks[name].owner == owner {
+		delete(s.locks, name)
+	}
+	return nil
+}
+
+// keptVersion is the version stored after a write: an unversioned write keeps the stored one
+func keptVersion(stored, incoming int64) int64 {
+	if incoming > 0 {
+		return incoming
+	}
+	return stored
+}
+
+// isStale reports whether an incoming version must not overwrite the stored one. An equal
+// version is a redelivery and is applied again.
+func isStale(stored, incoming int64) bool {
+	return incoming > 0 && stored > incoming
+}
+
+// paginate orders an in-memory result set by position and applies the query the way
+// MongoDB does
+func paginate[T any](items []T, position func(T) Position, query ListQuery) []T {
+	compare := func(a, b Position) int {
+		if query.Sort.Descending {
+			return comparePositions(b, a)
+		}
+		return comparePositions(a, b)
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		return compare(position(a), position(b))
+	})
+
+	switch {
+	case query.After != nil:
+		query.Skip = 0
+		items = items[sort.Search(len(items), func(i int) bool {
+			return compare(position(items[i]), *query.After) > 0
+		}):]
+	case query.Before != nil:
+		items = items[:sort.Search(len(items), func(i int) bool {
+			return compare(position(items[i]), *query.Before) >= 0
+		})]
+		if query.Limit > 0 && query.Limit < int64(len(items)) {
+			items = items[int64(len(items))-query.Limit:]
+		}
+		return items
+	}
+
+	if query.Skip >= int64(len(items)) {
+		return []T{}
+	}
+	if query.Skip > 0 {
+		items = items[query.Skip:]
+	}
+	if query.Limit > 0 && query.Limit < int64(len(items)) {
+		items = items[:query.Limit]
+	}
+	return items
+}
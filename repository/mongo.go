@@ -0,0 +1,472 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"query-service/apperror"
+	"query-service/models"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// MongoProductRepository stores products in a MongoDB collection
+type MongoProductRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoProductRepository creates a product repository backed by the given collection
+func NewMongoProductRepository(collection *mongo.Collection) *MongoProductRepository {
+	return &MongoProductRepository{collection: collection}
+}
+
+func (r *MongoProductRepository) FindByID(ctx context.Context, productID string) (models.Product, error) {
+	var product models.Product
+	err := r.collection.FindOne(ctx, bson.M{"productId": productID}).Decode(&product)
+	return product, mapError(err)
+}
+
+func (r *MongoProductRepository) FindByCategory(ctx context.Context, filter ProductFilter, query ListQuery) ([]models.Product, error) {
+	return findPage[models.Product](ctx, r.collection, productFilter(filter), "productId", query)
+}
+
+// productFilter translates a ProductFilter into a MongoDB query
+func productFilter(filter ProductFilter) bson.M {
+	query := bson.M{"category.id": filter.CategoryID}
+	if filter.IncludeSubcategories {
+		query = bson.M{"$or": bson.A{
+			bson.M{"category.id": filter.CategoryID},
+			bson.M{"category.parentCategory.id": filter.CategoryID},
+		}}
+	}
+
+	price := bson.M{}
+	if filter.MinPrice != nil {
+		price["$gte"] = *filter.MinPrice
+	}
+	if filter.MaxPrice != nil {
+		price["$lte"] = *filter.MaxPrice
+	}
+	if len(price) > 0 {
+		query["price"] = price
+	}
+	if filter.InStock {
+		query["currentInventory"] = bson.M{"$gt": 0}
+	}
+	if len(filter.Attributes) > 0 {
+		all := bson.A{}
+		for _, attr := range filter.Attributes {
+			all = append(all, bson.M{"$elemMatch": bson.M{"name": attr.Name, "value": attr.Value}})
+		}
+		query["attributes"] = bson.M{"$all": all}
+	}
+	return query
+}
+
+// Upsert sets every field rather than replacing the document, so an unversioned product,
+// whose version is left out, keeps the stored version
+func (r *MongoProductRepository) Upsert(ctx context.Context, product models.Product) error {
+	id := bson.M{"productId": product.ProductID}
+	_, err := r.collection.UpdateOne(
+		ctx,
+		notNewerThan(id, product.Version),
+		bson.M{"$set": product},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert found no document at or below the version and collided with a newer one
+		return staleOr(ctx, r.collection, id, product.Version, ErrDuplicate)
+	}
+	return err
+}
+
+func (r *MongoProductRepository) Update(ctx context.Context, product models.Product) error {
+	id := bson.M{"productId": product.ProductID}
+	result, err := r.collection.UpdateOne(
+		ctx,
+		notNewerThan(id, product.Version),
+		bson.M{"$set": product},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return staleOr(ctx, r.collection, id, product.Version, nil)
+	}
+	return nil
+}
+
+func (r *MongoProductRepository) SetInventory(ctx context.Context, productID string, quantity int, version int64) (models.Product, error) {
+	id := bson.M{"productId": productID}
+	set := bson.M{"currentInventory": quantity}
+	if version > 0 {
+		set["version"] = version
+	}
+
+	var product models.Product
+	err := r.collection.FindOneAndUpdate(
+		ctx,
+		notNewerThan(id, version),
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return product, staleOr(ctx, r.collection, id, version, ErrNotFound)
+	}
+	return product, err
+}
+
+// scanBatchSize is how many products a Scan cursor fetches per round trip
+const scanBatchSize = 500
+
+func (r *MongoProductRepository) Scan(ctx context.Context, afterID string, fn func(models.Product) error) error {
+	filter := bson.M{}
+	if afterID != "" {
+		filter["productId"] = bson.M{"$gt": afterID}
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "productId", Value: 1}}).
+		SetBatchSize(scanBatchSize)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return mapError(err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			return err
+		}
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	return mapError(cursor.Err())
+}
+
+func (r *MongoProductRepository) Count(ctx context.Context) (int64, error) {
+	count, err := r.collection.EstimatedDocumentCount(ctx)
+	return count, mapError(err)
+}
+
+// MongoOrderRepository stores orders in a MongoDB collection
+type MongoOrderRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOrderRepository creates an order repository backed by the given collection
+func NewMongoOrderRepository(collection *mongo.Collection) *MongoOrderRepository {
+	return &MongoOrderRepository{collection: collection}
+}
+
+func (r *MongoOrderRepository) FindByID(ctx context.Context, orderID string) (models.Order, error) {
+	var order models.Order
+	err := r.collection.FindOne(ctx, bson.M{"orderId": orderID}).Decode(&order)
+	return order, mapError(err)
+}
+
+func (r *MongoOrderRepository) FindByCustomer(ctx context.Context, customerID string, query ListQuery) ([]models.Order, error) {
+	return findPage[models.Order](ctx, r.collection, bson.M{"customerId": customerID}, "orderId", query)
+}
+
+// Upsert sets every field rather than replacing the document, so an unversioned order,
+// whose version is left out, keeps the stored version
+func (r *MongoOrderRepository) Upsert(ctx context.Context, order models.Order) error {
+	id := bson.M{"orderId": order.OrderID}
+	_, err := r.collection.UpdateOne(
+		ctx,
+		notNewerThan(id, order.Version),
+		bson.M{"$set": order},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The upsert found no document at or below the version and collided with a newer one
+		return staleOr(ctx, r.collection, id, order.Version, ErrDuplicate)
+	}
+	return err
+}
+
+func (r *MongoOrderRepository) UpdateStatus(ctx context.Context, orderID, status string, version int64, updated time.Time) error {
+	id := bson.M{"orderId": orderID}
+	set := bson.M{
+		"status":  status,
+		"updated": updated,
+	}
+	if version > 0 {
+		set["version"] = version
+	}
+
+	result, err := r.collection.UpdateOne(ctx, notNewerThan(id, version), bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return staleOr(ctx, r.collection, id, version, nil)
+	}
+	return nil
+}
+
+// MongoCustomerRepository stores customers in a MongoDB collection
+type MongoCustomerRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCustomerRepository creates a customer repository backed by the given collection
+func NewMongoCustomerRepository(collection *mongo.Collection) *MongoCustomerRepository {
+	return &MongoCustomerRepository{collection: collection}
+}
+
+func (r *MongoCustomerRepository) FindByID(ctx context.Context, customerID string) (models.Customer, error) {
+	var customer models.Customer
+	err := r.collection.FindOne(ctx, bson.M{"customerId": customerID}).Decode(&customer)
+	return customer, mapError(err)
+}
+
+func (r *MongoCustomerRepository) AppendOrderHistory(ctx context.Context, customerID string, entry models.OrderHistoryEntry, version int64) error {
+	update := bson.M{"$push": bson.M{"orderHistory": entry}}
+	if version > 0 {
+		update["$set"] = bson.M{"version": version}
+	}
+
+	id := bson.M{"customerId": customerID}
+	result, err := r.collection.UpdateOne(
+		ctx,
+		notNewerThan(bson.M{
+			"customerId":           customerID,
+			"orderHistory.orderId": bson.M{"$ne": entry.OrderID},
+		}, version),
+		update,
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// Either the history holds the order already, the customer is unknown or it is newer
+		return staleOr(ctx, r.collection, id, version, nil)
+	}
+	return nil
+}
+
+func (r *MongoCustomerRepository) UpdateOrderHistoryStatus(ctx context.Context, customerID, orderID, status string, version int64) error {
+	set := bson.M{"orderHistory.$.status": status}
+	if version > 0 {
+		set["version"] = version
+	}
+
+	id := bson.M{"customerId": customerID}
+	result, err := r.collection.UpdateOne(
+		ctx,
+		notNewerThan(bson.M{
+			"customerId":           customerID,
+			"orderHistory.orderId": orderID,
+		}, version),
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return staleOr(ctx, r.collection, id, version, nil)
+	}
+	return nil
+}
+
+// MongoEventLedger stores processed event IDs in a collection with a TTL index on processedAt
+type MongoEventLedger struct {
+	collection *mongo.Collection
+}
+
+// NewMongoEventLedger creates an event ledger backed by the given collection
+func NewMongoEventLedger(collection *mongo.Collection) *MongoEventLedger {
+	return &MongoEventLedger{collection: collection}
+}
+
+func (l *MongoEventLedger) IsProcessed(ctx context.Context, eventID string) (bool, error) {
+	err := l.collection.FindOne(ctx, bson.M{"_id": eventID}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *MongoEventLedger) MarkProcessed(ctx context.Context, eventID, eventType string) error {
+	_, err := l.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": eventID},
+		bson.M{"$setOnInsert": bson.M{
+			"type":        eventType,
+			"processedAt": time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// MongoCheckpointStore stores reindex checkpoints in a MongoDB collection, keyed by name
+type MongoCheckpointStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoCheckpointStore creates a checkpoint store backed by the given collection
+func NewMongoCheckpointStore(collection *mongo.Collection) *MongoCheckpointStore {
+	return &MongoCheckpointStore{collection: collection}
+}
+
+func (s *MongoCheckpointStore) Load(ctx context.Context, name string) (ReindexCheckpoint, error) {
+	var checkpoint ReindexCheckpoint
+	err := s.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&checkpoint)
+	return checkpoint, mapError(err)
+}
+
+func (s *MongoCheckpointStore) Save(ctx context.Context, name string, checkpoint ReindexCheckpoint) error {
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": name}, checkpoint, options.Replace().SetUpsert(true))
+	return mapError(err)
+}
+
+func (s *MongoCheckpointStore) Delete(ctx context.Context, name string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": name})
+	return mapError(err)
+}
+
+// checkpointLockID is the ID of the lock document on name, kept next to its checkpoint
+func checkpointLockID(name string) string {
+	return "lock:" + name
+}
+
+// Lock matches the lock document only when owner holds it or it has expired, so taking a
+// lock held by another owner falls through to an insert that fails on the duplicate ID
+func (s *MongoCheckpointStore) Lock(ctx context.Context, name, owner string, ttl time.Duration) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": checkpointLockID(name),
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expires": now.Add(ttl)}}
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetUpsert(true)).Err()
+	switch err = mapError(err); {
+	case errors.Is(err, ErrDuplicate):
+		return ErrLocked
+	case errors.Is(err, ErrNotFound):
+		// The upsert inserted the document, so there was none to return
+		return nil
+	default:
+		return err
+	}
+}
+
+func (s *MongoCheckpointStore) Unlock(ctx context.Context, name, owner string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": checkpointLockID(name), "owner": owner})
+	return mapError(err)
+}
+
+// notNewerThan extends an ID filter to match only documents whose version is at most
+// version, so a redelivered event re-applies its own write. Documents written before
+// versioning have no version field and always match.
+func notNewerThan(id bson.M, version int64) bson.M {
+	filter := bson.M{}
+	for k, v := range id {
+		filter[k] = v
+	}
+	if version > 0 {
+		filter["$or"] = bson.A{
+			bson.M{"version": bson.M{"$lte": version}},
+			bson.M{"version": bson.M{"$exists": false}},
+		}
+	}
+	return filter
+}
+
+// staleOr returns ErrStale if the document already holds a newer version, and fallback otherwise
+func staleOr(ctx context.Context, collection *mongo.Collection, id bson.M, version int64, fallback error) error {
+	if version <= 0 {
+		return fallback
+	}
+
+	filter := bson.M{"version": bson.M{"$gt": version}}
+	for k, v := range id {
+		filter[k] = v
+	}
+	n, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrStale
+	}
+	return fallback
+}
+
+// findPage runs a paginated query ordered by the sort field, then idField. Keyset pages
+// add a range condition on both fields, so they are served from the (filter, sort field,
+// idField) index without skipping. Pages before a position are read backwards and reversed.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, idField string, query ListQuery) ([]T, error) {
+	field := string(query.Sort.field())
+	backward := query.Before != nil
+	direction, op := 1, "$gt"
+	if query.Sort.Descending != backward {
+		direction, op = -1, "$lt"
+	}
+
+	opts := options.Find().SetLimit(query.Limit)
+	switch {
+	case query.After != nil:
+		filter = bson.M{"$and": bson.A{filter, seek(field, idField, *query.After, op)}}
+	case query.Before != nil:
+		filter = bson.M{"$and": bson.A{filter, seek(field, idField, *query.Before, op)}}
+	default:
+		opts.SetSkip(query.Skip)
+	}
+	opts.SetSort(bson.D{{Key: field, Value: direction}, {Key: idField, Value: direction}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer cursor.Close(ctx)
+
+	results := []T{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, mapError(err)
+	}
+	if backward {
+		slices.Reverse(results)
+	}
+	return results, nil
+}
+
+// seek matches documents past pos in the direction of op ($gt or $lt)
+func seek(field, idField string, pos Position, op string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: pos.Value}},
+		bson.M{field: pos.Value, idField: bson.M{op: pos.ID}},
+	}}
+}
+
+// mapError translates driver errors into repository errors, and timeouts and connection
+// failures into typed errors the API can report as 504 and 503
+func mapError(err error) error {
+	var selection topology.ServerSelectionError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	case mongo.IsNetworkError(err) || errors.As(err, &selection):
+		return apperror.Unavailable("the database is unavailable", err)
+	case mongo.IsTimeout(err) || errors.Is(err, context.DeadlineExceeded):
+		return apperror.Timeout("the database did not respond in time", err)
+	default:
+		return err
+	}
+}
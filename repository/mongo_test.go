@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"query-service/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// An unversioned write must not $set version: 0 over the stored version, or a replayed
+// older event would pass notNewerThan again
+func TestUnversionedWritesLeaveVersionOut(t *testing.T) {
+	documents := map[string]interface{}{
+		"product":  models.Product{ProductID: "p1"},
+		"order":    models.Order{OrderID: "o1"},
+		"customer": models.Customer{CustomerID: "c1"},
+	}
+	for name, document := range documents {
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bson.Raw(raw).LookupErr("version"); err == nil {
+			t.Errorf("unversioned %s encodes a version field", name)
+		}
+	}
+
+	raw, err := bson.Marshal(models.Product{ProductID: "p1", Version: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, ok := bson.Raw(raw).Lookup("version").Int64OK(); !ok || version != 3 {
+		t.Errorf("versioned product encodes version %d, want 3", version)
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"query-service/models"
+	"time"
+)
+
+// ErrNotFound is returned when the requested document does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when inserting a document whose ID already exists
+var ErrDuplicate = errors.New("duplicate")
+
+// ErrLocked is returned when a lock is held by another owner
+var ErrLocked = errors.New("locked")
+
+// ErrStale is returned when a write carries a version below the stored one.
+// Writes with version zero are unversioned and always applied.
+var ErrStale = errors.New("stale version")
+
+// ProductRepository reads and writes the product projection
+type ProductRepository interface {
+	FindByID(ctx context.Context, productID string) (models.Product, error)
+	// FindByCategory lists the products matching filter, which always names a category
+	FindByCategory(ctx context.Context, filter ProductFilter, query ListQuery) ([]models.Product, error)
+	// Upsert inserts the product or replaces the existing one with the same ID
+	Upsert(ctx context.Context, product models.Product) error
+	Update(ctx context.Context, product models.Product) error
+	// SetInventory updates the stock level and version and returns the updated product
+	SetInventory(ctx context.Context, productID string, quantity int, version int64) (models.Product, error)
+	// Scan calls fn with every product whose ID sorts after afterID, in ID order, and stops
+	// at the first error fn returns. An empty afterID starts at the first product.
+	Scan(ctx context.Context, afterID string, fn func(models.Product) error) error
+	// Count estimates the number of stored products
+	Count(ctx context.Context) (int64, error)
+}
+
+// OrderRepository reads and writes the order projection
+type OrderRepository interface {
+	FindByID(ctx context.Context, orderID string) (models.Order, error)
+	FindByCustomer(ctx context.Context, customerID string, query ListQuery) ([]models.Order, error)
+	// Upsert inserts the order or replaces the existing one with the same ID
+	Upsert(ctx context.Context, order models.Order) error
+	UpdateStatus(ctx context.Context, orderID, status string, version int64, updated time.Time) error
+}
+
+// CustomerRepository reads and writes the customer projection
+type CustomerRepository interface {
+	FindByID(ctx context.Context, customerID string) (models.Customer, error)
+	// AppendOrderHistory adds the entry unless the history already holds that order.
+	// version is the customer's aggregate version; it returns ErrStale below the stored one.
+	AppendOrderHistory(ctx context.Context, customerID string, entry models.OrderHistoryEntry, version int64) error
+	UpdateOrderHistoryStatus(ctx context.Context, customerID, orderID, status string, version int64) error
+}
+
+// EventLedger records which events have already been projected so redeliveries can be skipped
+type EventLedger interface {
+	IsProcessed(ctx context.Context, eventID string) (bool, error)
+	MarkProcessed(ctx context.Context, eventID, eventType string) error
+}
+
+// ReindexCheckpoint records how far a reindex into Index has got: every product with an ID
+// up to AfterID has been copied
+type ReindexCheckpoint struct {
+	Index   string    `bson:"index" json:"index"`
+	AfterID string    `bson:"afterId" json:"afterId"`
+	Indexed int64     `bson:"indexed" json:"indexed"`
+	Updated time.Time `bson:"updated" json:"updated"`
+}
+
+// CheckpointStore keeps one reindex checkpoint per name so an interrupted reindex can resume
+type CheckpointStore interface {
+	// Load returns ErrNotFound when no checkpoint is stored under name
+	Load(ctx context.Context, name string) (ReindexCheckpoint, error)
+	Save(ctx context.Context, name string, checkpoint ReindexCheckpoint) error
+	Delete(ctx context.Context, name string) error
+	// Lock takes the lock on name for owner until ttl has passed, or extends it when owner
+	// holds it already. It returns ErrLocked while another owner holds an unexpired lock.
+	Lock(ctx context.Context, name, owner string, ttl time.Duration) error
+	// Unlock releases the lock on name if owner holds it
+	Unlock(ctx context.Context, name, owner string) error
+}
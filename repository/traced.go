@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"query-service/models"
+	"query-service/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// The Traced* wrappers record a span around every call to the wrapped repository.
+// Not-found, duplicate and stale results are expected outcomes and are not marked as errors.
+
+var expectedErrors = []error{ErrNotFound, ErrDuplicate, ErrStale, ErrLocked}
+
+// TracedProductRepository traces a ProductRepository
+type TracedProductRepository struct {
+	ProductRepository
+}
+
+func NewTracedProductRepository(r ProductRepository) *TracedProductRepository {
+	return &TracedProductRepository{ProductRepository: r}
+}
+
+func (r *TracedProductRepository) FindByID(ctx context.Context, productID string) (product models.Product, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.FindByID", attribute.String("product.id", productID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.FindByID(ctx, productID)
+}
+
+func (r *TracedProductRepository) FindByCategory(ctx context.Context, filter ProductFilter, query ListQuery) (products []models.Product, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.FindByCategory",
+		attribute.String("category.id", filter.CategoryID),
+		attribute.String("sort", string(query.Sort.field())),
+	)
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.FindByCategory(ctx, filter, query)
+}
+
+func (r *TracedProductRepository) Upsert(ctx context.Context, product models.Product) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.Upsert", attribute.String("product.id", product.ProductID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.Upsert(ctx, product)
+}
+
+func (r *TracedProductRepository) Update(ctx context.Context, product models.Product) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.Update", attribute.String("product.id", product.ProductID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.Update(ctx, product)
+}
+
+func (r *TracedProductRepository) SetInventory(ctx context.Context, productID string, quantity int, version int64) (product models.Product, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.SetInventory", attribute.String("product.id", productID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.SetInventory(ctx, productID, quantity, version)
+}
+
+func (r *TracedProductRepository) Scan(ctx context.Context, afterID string, fn func(models.Product) error) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.Scan", attribute.String("after.id", afterID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.Scan(ctx, afterID, fn)
+}
+
+func (r *TracedProductRepository) Count(ctx context.Context) (count int64, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "products.Count")
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.ProductRepository.Count(ctx)
+}
+
+// TracedOrderRepository traces an OrderRepository
+type TracedOrderRepository struct {
+	OrderRepository
+}
+
+func NewTracedOrderRepository(r OrderRepository) *TracedOrderRepository {
+	return &TracedOrderRepository{OrderRepository: r}
+}
+
+func (r *TracedOrderRepository) FindByID(ctx context.Context, orderID string) (order models.Order, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "orders.FindByID", attribute.String("order.id", orderID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.OrderRepository.FindByID(ctx, orderID)
+}
+
+func (r *TracedOrderRepository) FindByCustomer(ctx context.Context, customerID string, query ListQuery) (orders []models.Order, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "orders.FindByCustomer", attribute.String("customer.id", customerID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.OrderRepository.FindByCustomer(ctx, customerID, query)
+}
+
+func (r *TracedOrderRepository) Upsert(ctx context.Context, order models.Order) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "orders.Upsert", attribute.String("order.id", order.OrderID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.OrderRepository.Upsert(ctx, order)
+}
+
+func (r *TracedOrderRepository) UpdateStatus(ctx context.Context, orderID, status string, version int64, updated time.Time) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "orders.UpdateStatus", attribute.String("order.id", orderID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.OrderRepository.UpdateStatus(ctx, orderID, status, version, updated)
+}
+
+// TracedCustomerRepository traces a CustomerRepository
+type TracedCustomerRepository struct {
+	CustomerRepository
+}
+
+func NewTracedCustomerRepository(r CustomerRepository) *TracedCustomerRepository {
+	return &TracedCustomerRepository{CustomerRepository: r}
+}
+
+func (r *TracedCustomerRepository) FindByID(ctx context.Context, customerID string) (customer models.Customer, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "customers.FindByID", attribute.String("customer.id", customerID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.CustomerRepository.FindByID(ctx, customerID)
+}
+
+func (r *TracedCustomerRepository) AppendOrderHistory(ctx context.Context, customerID string, entry models.OrderHistoryEntry, version int64) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "customers.AppendOrderHistory", attribute.String("customer.id", customerID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.CustomerRepository.AppendOrderHistory(ctx, customerID, entry, version)
+}
+
+func (r *TracedCustomerRepository) UpdateOrderHistoryStatus(ctx context.Context, customerID, orderID, status string, version int64) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "customers.UpdateOrderHistoryStatus", attribute.String("customer.id", customerID))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return r.CustomerRepository.UpdateOrderHistoryStatus(ctx, customerID, orderID, status, version)
+}
+
+// TracedEventLedger traces an EventLedger
+type TracedEventLedger struct {
+	EventLedger
+}
+
+func NewTracedEventLedger(l EventLedger) *TracedEventLedger {
+	return &TracedEventLedger{EventLedger: l}
+}
+
+func (l *TracedEventLedger) IsProcessed(ctx context.Context, eventID string) (processed bool, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "processed_events.IsProcessed", attribute.String("event.id", eventID))
+	defer func() { tracing.End(span, err) }()
+	return l.EventLedger.IsProcessed(ctx, eventID)
+}
+
+func (l *TracedEventLedger) MarkProcessed(ctx context.Context, eventID, eventType string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "processed_events.MarkProcessed", attribute.String("event.id", eventID))
+	defer func() { tracing.End(span, err) }()
+	return l.EventLedger.MarkProcessed(ctx, eventID, eventType)
+}
+
+// TracedCheckpointStore traces a CheckpointStore
+type TracedCheckpointStore struct {
+	CheckpointStore
+}
+
+func NewTracedCheckpointStore(s CheckpointStore) *TracedCheckpointStore {
+	return &TracedCheckpointStore{CheckpointStore: s}
+}
+
+func (s *TracedCheckpointStore) Load(ctx context.Context, name string) (checkpoint ReindexCheckpoint, err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "reindex_checkpoints.Load", attribute.String("checkpoint.name", name))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return s.CheckpointStore.Load(ctx, name)
+}
+
+func (s *TracedCheckpointStore) Save(ctx context.Context, name string, checkpoint ReindexCheckpoint) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "reindex_checkpoints.Save", attribute.String("checkpoint.name", name))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return s.CheckpointStore.Save(ctx, name, checkpoint)
+}
+
+func (s *TracedCheckpointStore) Delete(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "reindex_checkpoints.Delete", attribute.String("checkpoint.name", name))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return s.CheckpointStore.Delete(ctx, name)
+}
+
+func (s *TracedCheckpointStore) Lock(ctx context.Context, name, owner string, ttl time.Duration) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "reindex_checkpoints.Lock", attribute.String("checkpoint.name", name))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return s.CheckpointStore.Lock(ctx, name, owner, ttl)
+}
+
+func (s *TracedCheckpointStore) Unlock(ctx context.Context, name, owner string) (err error) {
+	ctx, span := tracing.StartClient(ctx, "mongodb", "reindex_checkpoints.Unlock", attribute.String("checkpoint.name", name))
+	defer func() { tracing.End(span, err, expectedErrors...) }()
+	return s.CheckpointStore.Unlock(ctx, name, owner)
+}
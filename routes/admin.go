@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"query-service/apperror"
+	"query-service/search"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves operational endpoints that change or inspect shared state
+type AdminHandler struct {
+	indices  *search.IndexManager
+	synonyms *search.SynonymSet
+}
+
+// NewAdminHandler creates an AdminHandler managing the product search index and its synonyms
+func NewAdminHandler(indices *search.IndexManager, synonyms *search.SynonymSet) *AdminHandler {
+	return &AdminHandler{indices: indices, synonyms: synonyms}
+}
+
+// maxSynonymsBody bounds the request body of a synonyms update
+const maxSynonymsBody = 1 << 20
+
+// getSearchIndex reports the index behind the products alias and how its mapping differs
+// from the expected one
+func (h *AdminHandler) getSearchIndex(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	state, err := h.indices.Check(ctx)
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": state})
+}
+
+// startReindex rebuilds the search index from MongoDB in the background, resuming an
+// unfinished reindex unless fresh=true
+func (h *AdminHandler) startReindex(c *gin.Context) {
+	p := newParams(c)
+	fresh := p.boolQuery("fresh")
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// 409 while a reindex runs here or another process holds the reindex lock
+	status, err := h.indices.StartReindex(ctx, fresh)
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"data": status})
+}
+
+// getReindex reports the progress of the most recent reindex
+func (h *AdminHandler) getReindex(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": h.indices.Status()})
+}
+
+// getSynonyms lists the synonym rules in the synonyms file
+func (h *AdminHandler) getSynonyms(c *gin.Context) {
+	rules, err := h.synonyms.Rules()
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": search.SynonymsStatus{Rules: rules}})
+}
+
+// putSynonyms replaces the synonym rules and reloads the search analyzers
+func (h *AdminHandler) putSynonyms(c *gin.Context) {
+	var body struct {
+		Rules []string `json:"rules"`
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSynonymsBody)
+	if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil || body.Rules == nil {
+		writeProblem(c, apperror.Invalid("the request body must be a JSON object with a rules array",
+			apperror.InvalidParam{Name: "rules", Reason: "must be an array of strings"}), "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	status, err := h.synonyms.Replace(ctx, body.Rules)
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": status})
+}
+
+// reloadSynonyms reloads the search analyzers after the synonyms file was edited by hand
+func (h *AdminHandler) reloadSynonyms(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	status, err := h.synonyms.Reload(ctx)
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": status})
+}
+
+// requireToken rejects requests without the bearer token. Both sides are hashed first so
+// the comparison takes the same time whatever the length of the presented token.
+func requireToken(token string) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		presented, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		got := sha256.Sum256([]byte(presented))
+		if !ok || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			writeProblem(c, apperror.Unauthorized("a valid admin bearer token is required"), "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RegisterAdminRoutes registers the admin routes behind a bearer token
+func RegisterAdminRoutes(r *gin.RouterGroup, h *AdminHandler, token string) {
+	r.Use(requireToken(token))
+	r.GET("/search/index", h.getSearchIndex)
+	r.GET("/search/reindex", h.getReindex)
+	r.POST("/search/reindex", h.startReindex)
+	r.GET("/search/synonyms", h.getSynonyms)
+	r.PUT("/search/synonyms", h.putSynonyms)
+	r.POST("/search/synonyms/reload", h.reloadSynonyms)
+}
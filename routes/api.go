@@ -1,273 +1,420 @@
 package routes
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"query-service/cache"
-	"query-service/db"
+	"query-service/config"
+	"query-service/logging"
 	"query-service/models"
-	"strconv"
+	"query-service/repository"
+	"query-service/search"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// getProductByID retrieves a product by its ID, with Redis caching
-func getProductByID(c *gin.Context) {
-	id := c.Param("productId")
+// maxSearchWindow is Elasticsearch's default index.max_result_window: from + size may not exceed it
+const maxSearchWindow = 10000
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// maxSearchTextLength bounds the search text so a query can't grow arbitrarily expensive
+const maxSearchTextLength = 256
 
-	// Attempt to retrieve the product from Redis cache
-	cacheKey := "product:" + id
-	cachedProduct, err := cache.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		// If cache hit, return the cached product
-		var product models.Product
-		json.Unmarshal([]byte(cachedProduct), &product)
-		c.JSON(http.StatusOK, gin.H{"source": "cache", "data": product})
-		return
+// maxSuggestTextLength bounds the typed text suggestions are made for
+const maxSuggestTextLength = 64
+
+// suggestionsPerCategory caps the suggestions from a single category
+const suggestionsPerCategory = 3
+
+// Dependencies are the stores and cache policy a Handler is built from
+type Dependencies struct {
+	Products  repository.ProductRepository
+	Orders    repository.OrderRepository
+	Customers repository.CustomerRepository
+	Cache     cache.Cache
+	Search    search.SearchIndex
+	TTL       config.CacheConfig
+	API       config.APIConfig
+}
+
+// Handler serves the query API from the injected stores
+type Handler struct {
+	products  repository.ProductRepository
+	orders    repository.OrderRepository
+	search    search.SearchIndex
+	api       config.APIConfig
+	cursors   *cursorCodec
+	product   *cache.ReadThrough[models.Product]
+	inventory *cache.ReadThrough[int]
+	order     *cache.ReadThrough[models.Order]
+	customer  *cache.ReadThrough[models.Customer]
+	suggest   *cache.ReadThrough[[]search.Suggestion]
+
+	// Version-stamped list pages, keyed through cache.PageKey
+	cache          cache.Cache
+	categoryPages  *cache.ReadThrough[[]models.Product]
+	customerOrders *cache.ReadThrough[[]models.Order]
+}
+
+// NewHandler creates a Handler with read-through caches for each entity type
+func NewHandler(deps Dependencies) *Handler {
+	loadInventory := func(ctx context.Context, id string) (int, error) {
+		product, err := deps.Products.FindByID(ctx, id)
+		return product.CurrentInventory, err
 	}
 
-	// If cache miss, query MongoDB
-	var product models.Product
-	err = db.ProductCollection.FindOne(ctx, bson.M{"productId": id}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
-		return
+	beta := deps.TTL.EarlyRefreshBeta
+	return &Handler{
+		products: deps.Products,
+		orders:   deps.Orders,
+		search:   deps.Search,
+		api:      deps.API,
+		cursors:  newCursorCodec(deps.API.CursorSecret),
+
+		product: cache.NewReadThrough(deps.Cache, cache.ProductKey, deps.Products.FindByID, deps.TTL.ProductTTL.Duration).
+			WithEarlyRefresh(beta).
+			WithTags(func(p models.Product) []string { return []string{cache.ProductTag(p.ProductID)} }),
+		inventory: cache.NewReadThrough(deps.Cache, cache.InventoryKey, loadInventory, deps.TTL.InventoryTTL.Duration).
+			WithEarlyRefresh(beta),
+		order: cache.NewReadThrough(deps.Cache, cache.OrderKey, deps.Orders.FindByID, deps.TTL.OrderTTL.Duration).
+			WithEarlyRefresh(beta).
+			WithTags(func(o models.Order) []string { return []string{cache.OrderTag(o.OrderID)} }),
+		customer: cache.NewReadThrough(deps.Cache, cache.CustomerKey, deps.Customers.FindByID, deps.TTL.CustomerTTL.Duration).
+			WithEarlyRefresh(beta).
+			WithTags(customerTags),
+		suggest: cache.NewReadThrough[[]search.Suggestion](deps.Cache, nil, nil, deps.TTL.SuggestTTL.Duration),
+
+		cache: deps.Cache,
+		categoryPages: cache.NewReadThrough[[]models.Product](deps.Cache, nil, nil, deps.TTL.ListTTL.Duration).
+			WithTags(productPageTags),
+		customerOrders: cache.NewReadThrough[[]models.Order](deps.Cache, nil, nil, deps.TTL.ListTTL.Duration).
+			WithTags(orderPageTags),
 	}
+}
+
+// customerTags tags a customer with itself and every order in its history
+func customerTags(customer models.Customer) []string {
+	tags := []string{cache.CustomerTag(customer.CustomerID)}
+	for _, entry := range customer.OrderHistory {
+		tags = append(tags, cache.OrderTag(entry.OrderID))
+	}
+	return tags
+}
 
-	// Cache the product in Redis with a 1-hour expiration
-	productJSON, _ := json.Marshal(product)
-	cache.RedisClient.Set(ctx, cacheKey, productJSON, time.Hour)
+// productPageTags tags a page of products with every product on it
+func productPageTags(products []models.Product) []string {
+	tags := make([]string, 0, len(products))
+	for _, product := range products {
+		tags = append(tags, cache.ProductTag(product.ProductID))
+	}
+	return tags
+}
 
-	// Return the product from MongoDB
-	c.JSON(http.StatusOK, gin.H{"source": "database", "data": product})
+// orderPageTags tags a page of orders with every order on it
+func orderPageTags(orders []models.Order) []string {
+	tags := make([]string, 0, len(orders))
+	for _, order := range orders {
+		tags = append(tags, cache.OrderTag(order.OrderID))
+	}
+	return tags
 }
 
-// getProductsByCategory retrieves products by category ID, with pagination
-func getProductsByCategory(c *gin.Context) {
-	categoryID := c.Param("categoryId")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+// getProductByID retrieves a product by its ID, with Redis caching
+func (h *Handler) getProductByID(c *gin.Context) {
+	p := newParams(c)
+	productID := p.id("productId")
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Query MongoDB with pagination
-	var products []models.Product
-	cursor, err := db.ProductCollection.Find(ctx, bson.M{"category.id": categoryID}, options.Find().SetSkip(int64((page-1)*size)).SetLimit(int64(size)))
+	product, source, err := h.product.Get(ctx, productID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		writeProblem(c, err, "product not found")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var product models.Product
-		cursor.Decode(&product)
-		products = append(products, product)
-	}
 
-	// Return the products
-	c.JSON(http.StatusOK, gin.H{"data": products, "page": page, "size": size})
+	c.JSON(http.StatusOK, gin.H{"source": source, "data": product})
 }
 
-// getInventory retrieves the current inventory for a product, with Redis caching
-func getInventory(c *gin.Context) {
-	productID := c.Param("productId")
+// getProductsByCategory retrieves products by category ID, sorted and filtered, with pagination
+func (h *Handler) getProductsByCategory(c *gin.Context) {
+	p := newParams(c)
+	categoryID := p.id("categoryId")
+	filter, view := p.productListing(categoryID)
+	listKey := cache.CategoryListKey(categoryID)
+	req := p.list(h.api, h.cursors, listKey, view)
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Attempt to retrieve the inventory from Redis cache
-	cacheKey := "inventory:" + productID
-	cachedInventory, err := cache.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		// If cache hit, return the cached inventory
-		c.JSON(http.StatusOK, gin.H{"source": "cache", "data": cachedInventory})
+	// Query MongoDB with pagination, caching the page under the category's current version
+	products, source, err := cachedPage(ctx, h.cache, h.categoryPages, listKey, req,
+		func(ctx context.Context) ([]models.Product, error) {
+			return h.products.FindByCategory(ctx, filter, req.query())
+		})
+	if err != nil {
+		writeProblem(c, err, "")
 		return
 	}
 
-	// If cache miss, query MongoDB
-	var product models.Product
-	err = db.ProductCollection.FindOne(ctx, bson.M{"productId": productID}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	// Return the products with cursors to the neighbouring pages
+	c.JSON(http.StatusOK, listResponse(h.cursors, listKey, req, source, products, repository.ProductPosition(view.sort)))
+}
+
+// getInventory retrieves the current inventory for a product, with Redis caching
+func (h *Handler) getInventory(c *gin.Context) {
+	p := newParams(c)
+	productID := p.id("productId")
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
 		return
 	}
 
-	// Cache the inventory in Redis with a 10-minute expiration
-	cache.RedisClient.Set(ctx, cacheKey, product.CurrentInventory, 10*time.Minute)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	inventory, source, err := h.inventory.Get(ctx, productID)
+	if err != nil {
+		writeProblem(c, err, "product not found")
+		return
+	}
 
-	// Return the inventory from MongoDB
-	c.JSON(http.StatusOK, gin.H{"source": "database", "data": product.CurrentInventory})
+	c.JSON(http.StatusOK, gin.H{"source": source, "data": inventory})
 }
 
 // getOrderByID retrieves an order by its ID, with Redis caching
-func getOrderByID(c *gin.Context) {
-	id := c.Param("orderId")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Attempt to retrieve the order from Redis cache
-	cacheKey := "order:" + id
-	cachedOrder, err := cache.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		// If cache hit, return the cached order
-		var order models.Order
-		json.Unmarshal([]byte(cachedOrder), &order)
-		c.JSON(http.StatusOK, gin.H{"source": "cache", "data": order})
+func (h *Handler) getOrderByID(c *gin.Context) {
+	p := newParams(c)
+	orderID := p.id("orderId")
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
 		return
 	}
 
-	// If cache miss, query MongoDB
-	var order models.Order
-	err = db.OrderCollection.FindOne(ctx, bson.M{"orderId": id}).Decode(&order)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	order, source, err := h.order.Get(ctx, orderID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		writeProblem(c, err, "order not found")
 		return
 	}
 
-	// Cache the order in Redis with a 10-minute expiration
-	orderJSON, _ := json.Marshal(order)
-	cache.RedisClient.Set(ctx, cacheKey, orderJSON, 10*time.Minute)
-
-	// Return the order from MongoDB
-	c.JSON(http.StatusOK, gin.H{"source": "database", "data": order})
+	c.JSON(http.StatusOK, gin.H{"source": source, "data": order})
 }
 
 // getCustomerByID retrieves a customer by its ID, with Redis caching
-func getCustomerByID(c *gin.Context) {
-	id := c.Param("customerId")
+func (h *Handler) getCustomerByID(c *gin.Context) {
+	p := newParams(c)
+	customerID := p.id("customerId")
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Attempt to retrieve the customer from Redis cache
-	cacheKey := "customer:" + id
-	cachedCustomer, err := cache.RedisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
-		// If cache hit, return the cached customer
-		var customer models.Customer
-		json.Unmarshal([]byte(cachedCustomer), &customer)
-		c.JSON(http.StatusOK, gin.H{"source": "cache", "data": customer})
+	customer, source, err := h.customer.Get(ctx, customerID)
+	if err != nil {
+		writeProblem(c, err, "customer not found")
 		return
 	}
 
-	// If cache miss, query MongoDB
-	var customer models.Customer
-	err = db.CustomerCollection.FindOne(ctx, bson.M{"customerId": id}).Decode(&customer)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+	c.JSON(http.StatusOK, gin.H{"source": source, "data": customer})
+}
+
+// getCustomerOrders retrieves a customer's order history, with pagination
+func (h *Handler) getCustomerOrders(c *gin.Context) {
+	p := newParams(c)
+	customerID := p.id("customerId")
+	listKey := cache.CustomerOrdersListKey(customerID)
+	req := p.list(h.api, h.cursors, listKey, listView{})
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
 		return
 	}
 
-	// Cache the customer in Redis with a 10-minute expiration
-	customerJSON, _ := json.Marshal(customer)
-	cache.RedisClient.Set(ctx, cacheKey, customerJSON, 10*time.Minute)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// Query MongoDB with pagination, caching the page under the customer's current version
+	orders, source, err := cachedPage(ctx, h.cache, h.customerOrders, listKey, req,
+		func(ctx context.Context) ([]models.Order, error) {
+			return h.orders.FindByCustomer(ctx, customerID, req.query())
+		})
+	if err != nil {
+		writeProblem(c, err, "")
+		return
+	}
 
-	// Return the customer from MongoDB
-	c.JSON(http.StatusOK, gin.H{"source": "database", "data": customer})
+	// Return the orders with cursors to the neighbouring pages
+	c.JSON(http.StatusOK, listResponse(h.cursors, listKey, req, source, orders, repository.OrderPosition))
 }
 
-// getCustomerOrders retrieves a customer's order history, with pagination
-func getCustomerOrders(c *gin.Context) {
-	customerID := c.Param("customerId")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+// searchProducts searches for products using Elasticsearch, with optional filters, facets
+// and highlighted snippets, and a corrected query when nothing matched
+func (h *Handler) searchProducts(c *gin.Context) {
+	p := newParams(c)
+	query := search.Query{
+		Text:             c.Query("q"),
+		CategoryID:       p.idQuery("category"),
+		ParentCategoryID: p.idQuery("parentCategory"),
+		MinPrice:         p.priceQuery("minPrice"),
+		MaxPrice:         p.priceQuery("maxPrice"),
+		InStock:          p.boolQuery("inStock"),
+		Attributes:       p.attributes(),
+	}
+	if len(query.Text) > maxSearchTextLength {
+		p.reject("q", fmt.Sprintf("must be at most %d bytes", maxSearchTextLength))
+	}
+	p.checkPriceRange(query.MinPrice, query.MaxPrice)
+	page := p.page(h.api)
+	if page.Skip()+page.Size > maxSearchWindow {
+		p.reject("page", fmt.Sprintf("page * size must not exceed %d", maxSearchWindow))
+	}
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
+		return
+	}
+	query.From = page.Skip()
+	query.Size = page.Size
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Query MongoDB with pagination
-	var orders []models.Order
-	cursor, err := db.OrderCollection.Find(ctx, bson.M{"customerId": customerID}, options.Find().SetSkip(int64((page-1)*size)).SetLimit(int64(size)))
+	result, err := h.search.Search(ctx, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch orders"})
+		writeProblem(c, err, "")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var order models.Order
-		cursor.Decode(&order)
-		orders = append(orders, order)
+	body := gin.H{
+		"data":   result.Hits,
+		"total":  result.Total,
+		"facets": result.Facets,
+		"page":   page.Page,
+		"size":   page.Size,
 	}
-
-	// Return the orders
-	c.JSON(http.StatusOK, gin.H{"data": orders, "page": page, "size": size})
+	if result.DidYouMean != "" {
+		body["didYouMean"] = result.DidYouMean
+	}
+	c.JSON(http.StatusOK, body)
 }
 
-// searchProducts searches for products using Elasticsearch
-func searchProducts(c *gin.Context) {
-	query := c.Query("q")
-	categoryID := c.Query("category")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
-
-	// Build Elasticsearch query with pagination and category filter
-	searchBody := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{"multi_match": map[string]interface{}{
-						"query":  query,
-						"fields": []string{"name", "description", "category.name"},
-					}},
-				},
-				"filter": []map[string]interface{}{
-					{"term": map[string]interface{}{"category.id": categoryID}},
-				},
-			},
-		},
-		"from": (page - 1) * size,
-		"size": size,
-	}
-
-	// Serialize the query to JSON
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchBody); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode search query"})
+// suggestProducts returns type-ahead suggestions for partly typed search text, cached briefly
+func (h *Handler) suggestProducts(c *gin.Context) {
+	p := newParams(c)
+	// Normalize the text so differently spaced or cased variants share a cache entry
+	text := strings.Join(strings.Fields(strings.ToLower(c.Query("q"))), " ")
+	switch {
+	case text == "":
+		p.reject("q", "is required")
+	case len(text) > maxSuggestTextLength:
+		p.reject("q", fmt.Sprintf("must be at most %d bytes", maxSuggestTextLength))
+	}
+	size := p.intQuery("size", 10, 1, 20)
+	if err := p.err(); err != nil {
+		writeProblem(c, err, "")
 		return
 	}
 
-	// Perform the search request
-	res, err := db.ElasticsearchClient.Search(
-		db.ElasticsearchClient.Search.WithContext(context.Background()),
-		db.ElasticsearchClient.Search.WithIndex("products"),
-		db.ElasticsearchClient.Search.WithBody(&buf),
-	)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	query := search.SuggestQuery{Text: text, Size: size, PerCategory: suggestionsPerCategory}
+	suggestions, source, err := h.suggest.Fetch(ctx, cache.SuggestKey(text, size),
+		func(ctx context.Context) ([]search.Suggestion, error) {
+			return h.search.Suggest(ctx, query)
+		})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to execute search query"})
+		writeProblem(c, err, "")
 		return
 	}
-	defer res.Body.Close()
 
-	// Parse the response
-	var result map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse search response"})
-		return
+	c.JSON(http.StatusOK, gin.H{"source": source, "data": suggestions})
+}
+
+// getCacheStats reports read-through counters, including collapsed loads and early refreshes
+func (h *Handler) getCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"product":        h.product.Stats(),
+		"inventory":      h.inventory.Stats(),
+		"order":          h.order.Stats(),
+		"customer":       h.customer.Stats(),
+		"suggest":        h.suggest.Stats(),
+		"categoryPages":  h.categoryPages.Stats(),
+		"customerOrders": h.customerOrders.Stats(),
+	}})
+}
+
+// cachedPage serves one page of a version-stamped list. If the version can't be read
+// the page is loaded directly so a stale version is never written.
+func cachedPage[T any](ctx context.Context, c cache.Cache, pages *cache.ReadThrough[T], listKey string, req listRequest,
+	load func(context.Context) (T, error)) (T, cache.Source, error) {
+	version, err := cache.ListVersion(ctx, c, listKey)
+	if err != nil {
+		logging.FromContext(ctx).Warn("failed to read list version", slog.String(logging.KeyCacheKey, listKey), logging.Err(err))
+		value, err := load(ctx)
+		return value, cache.SourceDatabase, err
 	}
+	return pages.Fetch(ctx, req.cacheKey(listKey, version), load)
+}
 
-	// Return the search results
-	c.JSON(http.StatusOK, result)
+// listResponse builds the envelope for one page of a list. items holds up to one item
+// more than the page size, which only signals that the list continues in the direction
+// of travel. nextCursor and prevCursor are set when there are items after or before the page.
+func listResponse[T any](codec *cursorCodec, listKey string, req listRequest, source cache.Source, items []T,
+	position func(T) repository.Position) gin.H {
+	backward := req.cursor != nil && req.cursor.Backward
+	more := len(items) > req.Size
+	if more && backward {
+		items = items[len(items)-req.Size:]
+	} else if more {
+		items = items[:req.Size]
+	}
+
+	body := gin.H{"source": source, "data": items, "size": req.Size}
+	if req.cursor == nil {
+		body["page"] = req.Page
+	}
+	if len(items) == 0 {
+		return body
+	}
+
+	// A backward page always has the page it was reached from after it; a forward page
+	// has earlier items when it was reached by cursor or is not the first page
+	hasNext := more || backward
+	hasPrev := (more && backward) || (!backward && (req.cursor != nil || req.Page > 1))
+	if hasNext {
+		body["nextCursor"] = codec.encode(listKey, req.view.variant, cursor{Sort: req.view.sort, Position: position(items[len(items)-1])})
+	}
+	if hasPrev {
+		body["prevCursor"] = codec.encode(listKey, req.view.variant, cursor{Sort: req.view.sort, Position: position(items[0]), Backward: true})
+	}
+	return body
 }
 
 // RegisterRoutes registers all API routes
-func RegisterRoutes(r *gin.RouterGroup) {
-	r.GET("/products/:productId", getProductByID)
-	r.GET("/products/category/:categoryId", getProductsByCategory)
-	r.GET("/inventory/:productId", getInventory)
-	r.GET("/orders/:orderId", getOrderByID)
-	r.GET("/customers/:customerId", getCustomerByID)
-	r.GET("/customers/:customerId/orders", getCustomerOrders)
-	r.GET("/products/search", searchProducts)
+func RegisterRoutes(r *gin.RouterGroup, h *Handler) {
+	r.GET("/products/:productId", h.getProductByID)
+	r.GET("/products/category/:categoryId", h.getProductsByCategory)
+	r.GET("/inventory/:productId", h.getInventory)
+	r.GET("/orders/:orderId", h.getOrderByID)
+	r.GET("/customers/:customerId", h.getCustomerByID)
+	r.GET("/customers/:customerId/orders", h.getCustomerOrders)
+	r.GET("/products/search", h.searchProducts)
+	r.GET("/products/suggest", h.suggestProducts)
+	r.GET("/cache/stats", h.getCacheStats)
 }
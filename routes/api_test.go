@@ -0,0 +1,287 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"query-service/apperror"
+	"query-service/cache"
+	"query-service/config"
+	"query-service/models"
+	"query-service/repository"
+	"query-service/search"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testProducts are five phones in category c1, created a minute apart, and a laptop in c2
+func testProducts() []models.Product {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var products []models.Product
+	for i := 1; i <= 5; i++ {
+		products = append(products, models.Product{
+			ProductID:   fmt.Sprintf("p%d", i),
+			Name:        fmt.Sprintf("Phone %d", i),
+			Description: "A smartphone",
+			Price:       float64(100 * i),
+			Category:    models.Category{ID: "c1", Name: "Phones"},
+			Created:     created.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return append(products, models.Product{
+		ProductID:   "p6",
+		Name:        "Laptop",
+		Description: "A thin notebook",
+		Price:       900,
+		Category:    models.Category{ID: "c2", Name: "Laptops"},
+		Created:     created,
+	})
+}
+
+// newTestRouter serves the query API from memory stores holding products
+func newTestRouter(t *testing.T, products []models.Product) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	index := search.NewMemoryIndex()
+	for _, product := range products {
+		if err := index.IndexProduct(context.Background(), product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	RegisterRoutes(r.Group("/api/queries"), NewHandler(Dependencies{
+		Products:  repository.NewMemoryProductRepository(products...),
+		Orders:    repository.NewMemoryOrderRepository(),
+		Customers: repository.NewMemoryCustomerRepository(),
+		Cache:     cache.NewMemoryCache(),
+		Search:    index,
+		TTL: config.CacheConfig{
+			ProductTTL:   config.Duration{Duration: time.Minute},
+			InventoryTTL: config.Duration{Duration: time.Minute},
+			OrderTTL:     config.Duration{Duration: time.Minute},
+			CustomerTTL:  config.Duration{Duration: time.Minute},
+			ListTTL:      config.Duration{Duration: time.Minute},
+			SuggestTTL:   config.Duration{Duration: time.Minute},
+		},
+		API: config.APIConfig{DefaultPageSize: 10, MaxPageSize: 50, CursorSecret: "test-secret"},
+	}))
+	return r
+}
+
+// get serves a GET of target and decodes the JSON response body into body
+func get(t *testing.T, r http.Handler, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), body); err != nil {
+		t.Fatalf("GET %s: invalid JSON body %q: %v", target, w.Body.String(), err)
+	}
+	return w
+}
+
+type productPage struct {
+	Data       []models.Product `json:"data"`
+	Page       int              `json:"page"`
+	Size       int              `json:"size"`
+	NextCursor string           `json:"nextCursor"`
+	PrevCursor string           `json:"prevCursor"`
+}
+
+func productIDs(products []models.Product) []string {
+	ids := make([]string, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ProductID)
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, what string, got []models.Product, want ...string) {
+	t.Helper()
+	ids := productIDs(got)
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("%s: got products %v, want %v", what, ids, want)
+	}
+}
+
+func TestGetProductByID(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var body struct {
+		Source cache.Source   `json:"source"`
+		Data   models.Product `json:"data"`
+	}
+	w := get(t, r, "/api/queries/products/p2", &body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	if body.Data.ProductID != "p2" || body.Data.Name != "Phone 2" {
+		t.Errorf("got product %+v, want p2", body.Data)
+	}
+	if body.Source != cache.SourceDatabase {
+		t.Errorf("first read served from %q, want %q", body.Source, cache.SourceDatabase)
+	}
+
+	get(t, r, "/api/queries/products/p2", &body)
+	if body.Source != cache.SourceCache {
+		t.Errorf("second read served from %q, want %q", body.Source, cache.SourceCache)
+	}
+}
+
+func TestGetProductByIDNotFound(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var problem Problem
+	w := get(t, r, "/api/queries/products/missing", &problem)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Errorf("content type %q, want %q", ct, problemContentType)
+	}
+	if problem.Status != http.StatusNotFound || problem.Type != "/problems/"+string(apperror.KindNotFound) ||
+		problem.Detail != "product not found" || problem.Instance != "/api/queries/products/missing" {
+		t.Errorf("got problem %+v", problem)
+	}
+}
+
+func TestGetProductByIDInvalid(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var problem Problem
+	w := get(t, r, "/api/queries/products/bad:id", &problem)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "productId" {
+		t.Errorf("got invalid params %+v, want productId", problem.InvalidParams)
+	}
+}
+
+func TestGetProductsByCategoryPages(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var page productPage
+	w := get(t, r, "/api/queries/products/category/c1?size=2&page=2", &page)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	assertIDs(t, "page 2", page.Data, "p3", "p4")
+	if page.Page != 2 || page.Size != 2 || page.NextCursor == "" || page.PrevCursor == "" {
+		t.Errorf("got page %d size %d, next %q, prev %q", page.Page, page.Size, page.NextCursor, page.PrevCursor)
+	}
+
+	var last productPage
+	get(t, r, "/api/queries/products/category/c1?size=2&page=3", &last)
+	assertIDs(t, "page 3", last.Data, "p5")
+	if last.NextCursor != "" {
+		t.Errorf("last page has a next cursor")
+	}
+
+	var empty productPage
+	get(t, r, "/api/queries/products/category/c1?size=2&page=4", &empty)
+	assertIDs(t, "page 4", empty.Data)
+}
+
+func TestGetProductsByCategoryCursors(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+	base := "/api/queries/products/category/c1?sort=price&order=desc&size=2"
+
+	var first productPage
+	get(t, r, base, &first)
+	assertIDs(t, "first page", first.Data, "p5", "p4")
+	if first.PrevCursor != "" {
+		t.Errorf("first page has a previous cursor")
+	}
+
+	var next productPage
+	w := get(t, r, base+"&cursor="+url.QueryEscape(first.NextCursor), &next)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	assertIDs(t, "next page", next.Data, "p3", "p2")
+
+	var prev productPage
+	get(t, r, base+"&cursor="+url.QueryEscape(next.PrevCursor), &prev)
+	assertIDs(t, "previous page", prev.Data, "p5", "p4")
+
+	// A cursor only applies to the sort order it was issued for
+	var problem Problem
+	w = get(t, r, "/api/queries/products/category/c1?size=2&cursor="+url.QueryEscape(first.NextCursor), &problem)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("cursor reused with another sort: status %d, want 400", w.Code)
+	}
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "cursor" {
+		t.Errorf("got invalid params %+v, want cursor", problem.InvalidParams)
+	}
+}
+
+func TestGetProductsByCategoryInvalidPage(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var problem Problem
+	w := get(t, r, "/api/queries/products/category/c1?size=51&page=0", &problem)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	names := map[string]bool{}
+	for _, param := range problem.InvalidParams {
+		names[param.Name] = true
+	}
+	if !names["size"] || !names["page"] {
+		t.Errorf("got invalid params %+v, want size and page", problem.InvalidParams)
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var body struct {
+		Data       []search.Hit  `json:"data"`
+		Total      int64         `json:"total"`
+		Facets     search.Facets `json:"facets"`
+		Page       int           `json:"page"`
+		Size       int           `json:"size"`
+		DidYouMean string        `json:"didYouMean"`
+	}
+	w := get(t, r, "/api/queries/products/search?q=phone&maxPrice=300&size=2", &body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	if body.Total != 3 || len(body.Data) != 2 || body.Page != 1 || body.Size != 2 {
+		t.Fatalf("got %d of %d hits on page %d of size %d, want 2 of 3 on page 1 of size 2",
+			len(body.Data), body.Total, body.Page, body.Size)
+	}
+	for _, hit := range body.Data {
+		if hit.Product.Category.ID != "c1" || hit.Product.Price > 300 {
+			t.Errorf("hit %s outside the filters", hit.Product.ProductID)
+		}
+	}
+	if len(body.Facets.Categories) != 1 || body.Facets.Categories[0].Value != "c1" || body.Facets.Categories[0].Count != 3 {
+		t.Errorf("got category facets %+v, want c1 with 3", body.Facets.Categories)
+	}
+
+	get(t, r, "/api/queries/products/search?q=kaptop", &body)
+	if body.Total != 0 || body.DidYouMean != "laptop" {
+		t.Errorf("misspelled search got %d hits and correction %q, want none and laptop", body.Total, body.DidYouMean)
+	}
+}
+
+func TestSearchProductsInvalidParams(t *testing.T) {
+	r := newTestRouter(t, testProducts())
+
+	var problem Problem
+	w := get(t, r, "/api/queries/products/search?q=phone&minPrice=500&maxPrice=100", &problem)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	if len(problem.InvalidParams) != 1 || problem.InvalidParams[0].Name != "maxPrice" {
+		t.Errorf("got invalid params %+v, want maxPrice", problem.InvalidParams)
+	}
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"query-service/repository"
+	"strings"
+	"time"
+)
+
+// cursor is a decoded nextCursor/prevCursor token: the sort order it was issued for, the
+// position to continue from and whether the page lies before it
+type cursor struct {
+	Sort     repository.Sort
+	Position repository.Position
+	Backward bool
+}
+
+// cursorPayload is the signed part of a token
+type cursorPayload struct {
+	Field      repository.SortField `json:"f,omitempty"`
+	Descending bool                 `json:"d,omitempty"`
+	Value      json.RawMessage      `json:"v"`
+	ID         string               `json:"i"`
+	Backward   bool                 `json:"b,omitempty"`
+}
+
+// cursorCodec turns cursors into opaque tokens of the form payload.signature. The
+// signature is an HMAC over the list and view (sort and filters) the cursor was issued
+// for, so tokens can be neither forged nor replayed against another list or view, where
+// the position would silently skip rows.
+type cursorCodec struct {
+	key []byte
+}
+
+// newCursorCodec creates a codec keyed by secret, or by a random key when secret is empty
+func newCursorCodec(secret string) *cursorCodec {
+	if secret != "" {
+		return &cursorCodec{key: []byte(secret)}
+	}
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return &cursorCodec{key: key}
+}
+
+func (c *cursorCodec) encode(listKey, variant string, cur cursor) string {
+	value, _ := json.Marshal(cur.Position.Value)
+	payload, _ := json.Marshal(cursorPayload{
+		Field:      cur.Sort.Field,
+		Descending: cur.Sort.Descending,
+		Value:      value,
+		ID:         cur.Position.ID,
+		Backward:   cur.Backward,
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(listKey, variant, encoded))
+}
+
+// decode verifies token against listKey and the view variant and returns the cursor it carries
+func (c *cursorCodec) decode(listKey, variant, token string) (cursor, bool) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor{}, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(listKey, variant, encoded)) {
+		return cursor{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor{}, false
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return cursor{}, false
+	}
+	value, err := decodeSortValue(payload.Field, payload.Value)
+	if err != nil {
+		return cursor{}, false
+	}
+	return cursor{
+		Sort:     repository.Sort{Field: payload.Field, Descending: payload.Descending},
+		Position: repository.Position{Value: value, ID: payload.ID},
+		Backward: payload.Backward,
+	}, true
+}
+
+// decodeSortValue decodes a position value into the Go type the sort field holds
+func decodeSortValue(field repository.SortField, raw json.RawMessage) (interface{}, error) {
+	switch field {
+	case repository.SortPrice:
+		return decodeAs[float64](raw)
+	case repository.SortName:
+		return decodeAs[string](raw)
+	case repository.SortInventory:
+		return decodeAs[int](raw)
+	default:
+		return decodeAs[time.Time](raw)
+	}
+}
+
+func decodeAs[T any](raw json.RawMessage) (interface{}, error) {
+	var value T
+	err := json.Unmarshal(raw, &value)
+	return value, err
+}
+
+func (c *cursorCodec) sign(listKey, variant, encoded string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(listKey))
+	mac.Write([]byte{0})
+	mac.Write([]byte(variant))
+	mac.Write([]byte{0})
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"query-service/health"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthRoutes exposes liveness, readiness and per-dependency health:
+//
+//	GET /health        same as /health/live, kept for existing probes
+//	GET /health/live   200 while the process can serve HTTP; never pings dependencies
+//	GET /health/ready  200 when required dependencies are up and the consumer lag is in bounds, 503 otherwise
+//	GET /health/deps   the full report with per-dependency status and latency; 503 when not ready
+func RegisterHealthRoutes(r gin.IRouter, checker *health.Checker) {
+	live := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "OK"})
+	}
+	r.GET("/health", live)
+	r.GET("/health/live", live)
+
+	r.GET("/health/ready", func(c *gin.Context) {
+		report := runHealthChecks(c, checker)
+		if !report.Ready {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "consumerLag": report.ConsumerLag, "dependencies": report.Dependencies})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
+	})
+
+	r.GET("/health/deps", func(c *gin.Context) {
+		report := runHealthChecks(c, checker)
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	})
+}
+
+func runHealthChecks(c *gin.Context, checker *health.Checker) health.Report {
+	// Each check has its own timeout; this only bounds a stuck request as a whole
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	return checker.Run(ctx)
+}
@@ -0,0 +1,281 @@
+package routes
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"query-service/apperror"
+	"query-service/cache"
+	"query-service/config"
+	"query-service/models"
+	"query-service/repository"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idPattern accepts the IDs the upstream services issue. Colons are excluded because IDs
+// are embedded in colon-separated cache keys.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// pagination is a validated page request
+type pagination struct {
+	Page int
+	Size int
+}
+
+// Skip returns how many results precede the page
+func (p pagination) Skip() int {
+	return (p.Page - 1) * p.Size
+}
+
+// listView is how a list is sorted and filtered. variant is a canonical, colon-free
+// form of the filters and sort, used to cache each view separately.
+type listView struct {
+	sort    repository.Sort
+	variant string
+}
+
+// listRequest is a validated list page request, addressed either by page number or by
+// a cursor token from a previous response
+type listRequest struct {
+	pagination
+	view   listView
+	cursor *cursor
+	token  string
+}
+
+// query is the repository query for the page. It asks for one item more than the page
+// size to learn whether another page follows.
+func (r listRequest) query() repository.ListQuery {
+	query := repository.ListQuery{Sort: r.view.sort, Limit: int64(r.Size) + 1}
+	switch {
+	case r.cursor == nil:
+		query.Skip = int64(r.Skip())
+	case r.cursor.Backward:
+		query.Before = &r.cursor.Position
+	default:
+		query.After = &r.cursor.Position
+	}
+	return query
+}
+
+// cacheKey is the key the page is cached under at the given list version
+func (r listRequest) cacheKey(listKey string, version int64) string {
+	if r.cursor == nil {
+		return cache.PageKey(listKey, version, r.view.variant, r.Page, r.Size)
+	}
+	return cache.CursorPageKey(listKey, version, r.view.variant, r.token, r.Size)
+}
+
+// params reads request parameters, collecting every invalid one so a single 400 can
+// list them all
+type params struct {
+	c       *gin.Context
+	invalid []apperror.InvalidParam
+}
+
+func newParams(c *gin.Context) *params {
+	return &params{c: c}
+}
+
+func (p *params) reject(name, reason string) {
+	p.invalid = append(p.invalid, apperror.InvalidParam{Name: name, Reason: reason})
+}
+
+// id returns the named path parameter, rejecting it unless it is a well-formed ID
+func (p *params) id(name string) string {
+	id := p.c.Param(name)
+	if !idPattern.MatchString(id) {
+		p.reject(name, "must be 1-128 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	return id
+}
+
+// page returns the page and size query parameters, defaulting to the first page of
+// cfg.DefaultPageSize and rejecting sizes outside 1..cfg.MaxPageSize. Pages are bounded
+// so the skip still fits a 32-bit offset.
+func (p *params) page(cfg config.APIConfig) pagination {
+	size := p.intQuery("size", cfg.DefaultPageSize, 1, cfg.MaxPageSize)
+	return pagination{
+		Page: p.intQuery("page", 1, 1, math.MaxInt32/size),
+		Size: size,
+	}
+}
+
+// list returns a request for a page of view of listKey: a cursor and size when a cursor
+// is given, otherwise a page and size. Cursors only apply to the sort and filters they
+// were issued for.
+func (p *params) list(cfg config.APIConfig, codec *cursorCodec, listKey string, view listView) listRequest {
+	token, ok := p.c.GetQuery("cursor")
+	if !ok {
+		return listRequest{pagination: p.page(cfg), view: view}
+	}
+
+	req := listRequest{
+		pagination: pagination{Size: p.intQuery("size", cfg.DefaultPageSize, 1, cfg.MaxPageSize)},
+		view:       view,
+		token:      token,
+	}
+	if _, ok := p.c.GetQuery("page"); ok {
+		p.reject("page", "must not be combined with cursor")
+	}
+	cur, ok := codec.decode(listKey, view.variant, token)
+	if ok {
+		req.cursor = &cur
+	} else {
+		p.reject("cursor", "is malformed or was issued for another list, sort order or filter")
+	}
+	return req
+}
+
+// productSorts maps the sort parameter of category listings to stored fields
+var productSorts = map[string]repository.SortField{
+	"created":   repository.SortCreated,
+	"price":     repository.SortPrice,
+	"name":      repository.SortName,
+	"inventory": repository.SortInventory,
+}
+
+// productListing returns the filter and view of a category listing from the sort,
+// order, minPrice, maxPrice, inStock, attr (name:value, repeatable) and subcategories
+// query parameters
+func (p *params) productListing(categoryID string) (repository.ProductFilter, listView) {
+	filter := repository.ProductFilter{
+		CategoryID:           categoryID,
+		IncludeSubcategories: p.boolQuery("subcategories"),
+		MinPrice:             p.priceQuery("minPrice"),
+		MaxPrice:             p.priceQuery("maxPrice"),
+		InStock:              p.boolQuery("inStock"),
+		Attributes:           p.attributes(),
+	}
+	p.checkPriceRange(filter.MinPrice, filter.MaxPrice)
+
+	var sort repository.Sort
+	if raw, ok := p.c.GetQuery("sort"); ok {
+		field, known := productSorts[raw]
+		if !known {
+			p.reject("sort", "must be one of created, price, name, inventory")
+		}
+		sort.Field = field
+	}
+	switch order := p.c.DefaultQuery("order", "asc"); order {
+	case "asc":
+	case "desc":
+		sort.Descending = true
+	default:
+		p.reject("order", "must be asc or desc")
+	}
+
+	// Only the parsed values make up the variant, so unknown parameters can't multiply cache entries
+	variant := url.Values{}
+	if filter.IncludeSubcategories {
+		variant.Set("subcategories", "true")
+	}
+	if filter.MinPrice != nil {
+		variant.Set("minPrice", strconv.FormatFloat(*filter.MinPrice, 'f', -1, 64))
+	}
+	if filter.MaxPrice != nil {
+		variant.Set("maxPrice", strconv.FormatFloat(*filter.MaxPrice, 'f', -1, 64))
+	}
+	if filter.InStock {
+		variant.Set("inStock", "true")
+	}
+	for _, attr := range filter.Attributes {
+		variant.Add("attr", attr.Name+":"+attr.Value)
+	}
+	if sort.Field != "" {
+		variant.Set("sort", string(sort.Field))
+	}
+	if sort.Descending {
+		variant.Set("order", "desc")
+	}
+	return filter, listView{sort: sort, variant: variant.Encode()}
+}
+
+// attributes returns the repeatable attr query parameter as name/value pairs
+func (p *params) attributes() []models.Attribute {
+	var attributes []models.Attribute
+	for _, raw := range p.c.QueryArray("attr") {
+		name, value, ok := strings.Cut(raw, ":")
+		if !ok || name == "" || value == "" {
+			p.reject("attr", fmt.Sprintf("%q must be name:value", raw))
+			continue
+		}
+		attributes = append(attributes, models.Attribute{Name: name, Value: value})
+	}
+	return attributes
+}
+
+// checkPriceRange rejects a maxPrice below minPrice
+func (p *params) checkPriceRange(min, max *float64) {
+	if min != nil && max != nil && *min > *max {
+		p.reject("maxPrice", "must not be below minPrice")
+	}
+}
+
+// idQuery returns the named query parameter, rejecting it unless it is empty or a well-formed ID
+func (p *params) idQuery(name string) string {
+	id := p.c.Query(name)
+	if id != "" && !idPattern.MatchString(id) {
+		p.reject(name, "must be 1-128 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	return id
+}
+
+// boolQuery returns the named query parameter as a boolean, false when absent
+func (p *params) boolQuery(name string) bool {
+	raw, ok := p.c.GetQuery(name)
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		p.reject(name, "must be true or false")
+	}
+	return b
+}
+
+// priceQuery returns the named query parameter as a non-negative price, nil when absent
+func (p *params) priceQuery(name string) *float64 {
+	raw, ok := p.c.GetQuery(name)
+	if !ok {
+		return nil
+	}
+	price, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(price) || math.IsInf(price, 0) || price < 0 {
+		p.reject(name, "must be a non-negative number")
+		return nil
+	}
+	return &price
+}
+
+// intQuery returns the named query parameter as an integer between min and max
+func (p *params) intQuery(name string, def, min, max int) int {
+	raw, ok := p.c.GetQuery(name)
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	switch {
+	case err != nil:
+		p.reject(name, "must be an integer")
+	case n < min:
+		p.reject(name, fmt.Sprintf("must be at least %d", min))
+	case n > max:
+		p.reject(name, fmt.Sprintf("must be at most %d", max))
+	default:
+		return n
+	}
+	return def
+}
+
+// err returns a 400 error listing every rejected parameter, or nil
+func (p *params) err() error {
+	if len(p.invalid) == 0 {
+		return nil
+	}
+	return apperror.Invalid("the request has invalid parameters", p.invalid...)
+}
@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"query-service/apperror"
+	"query-service/logging"
+	"query-service/repository"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// problemContentType is the media type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body, extended with the IDs needed to find the
+// request in logs and traces
+type Problem struct {
+	Type          string                  `json:"type"`
+	Title         string                  `json:"title"`
+	Status        int                     `json:"status"`
+	Detail        string                  `json:"detail,omitempty"`
+	Instance      string                  `json:"instance,omitempty"`
+	TraceID       string                  `json:"traceId,omitempty"`
+	RequestID     string                  `json:"requestId,omitempty"`
+	InvalidParams []apperror.InvalidParam `json:"invalidParams,omitempty"`
+}
+
+// writeProblem aborts the request with err rendered as problem details. notFound is the
+// detail used when err is repository.ErrNotFound; untyped errors are reported as internal
+// and their cause is only logged.
+func writeProblem(c *gin.Context, err error, notFound string) {
+	var appErr *apperror.Error
+	if errors.Is(err, repository.ErrNotFound) {
+		appErr = apperror.NotFound("%s", notFound)
+	} else {
+		appErr = apperror.From(err, "the request could not be completed")
+	}
+
+	status := appErr.Kind.Status()
+	if status >= http.StatusInternalServerError {
+		logging.FromContext(c.Request.Context()).Error("request failed",
+			slog.String("kind", string(appErr.Kind)),
+			logging.Err(err),
+		)
+	}
+
+	problem := Problem{
+		Type:          "/problems/" + string(appErr.Kind),
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        appErr.Message,
+		Instance:      c.Request.URL.Path,
+		RequestID:     c.Writer.Header().Get(logging.RequestIDHeader),
+		InvalidParams: appErr.Params,
+	}
+	if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+		problem.TraceID = sc.TraceID().String()
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(status, problem)
+}
+
+// NoRoute reports unknown paths as problem details
+func NoRoute(c *gin.Context) {
+	writeProblem(c, apperror.NotFound("no route matches %s %s", c.Request.Method, c.Request.URL.Path), "")
+}
+
+// Recovered reports a handler panic as an internal problem
+func Recovered(c *gin.Context, recovered any) {
+	writeProblem(c, apperror.Internal("the request could not be completed", fmt.Errorf("panic: %v", recovered)), "")
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"query-service/models"
+)
+
+// bulkItem is one product written by a _bulk request
+type bulkItem struct {
+	index string
+	// requireAlias makes the write fail with 404 instead of creating an index when index is not an alias
+	requireAlias bool
+	// backfill writes a product at version 0 with external version 0 as well, so it only
+	// creates a missing document and never replaces one a live write indexed
+	backfill bool
+	product  models.Product
+}
+
+// bulkAction is the action line preceding each document in a _bulk request
+type bulkAction struct {
+	Index struct {
+		Index        string `json:"_index"`
+		ID           string `json:"_id"`
+		Version      *int64 `json:"version,omitempty"`
+		VersionType  string `json:"version_type,omitempty"`
+		RequireAlias bool   `json:"require_alias,omitempty"`
+	} `json:"index"`
+}
+
+// bulkResult is the outcome of one bulkItem
+type bulkResult struct {
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+// ok reports whether the write succeeded or was skipped because a newer version is indexed
+func (r bulkResult) ok() bool {
+	return r.Status < http.StatusMultipleChoices || r.Status == http.StatusConflict
+}
+
+func (r bulkResult) err() error {
+	return fmt.Errorf("product %s: status %d: %s", r.ID, r.Status, r.Error)
+}
+
+// encodeBulk encodes items as the newline-delimited body of a _bulk request. Products
+// with a version are written with external versioning; the others overwrite the indexed
+// document unless the item is a backfill.
+func encodeBulk(items []bulkItem) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, item := range items {
+		var action bulkAction
+		action.Index.Index = item.index
+		action.Index.ID = item.product.ProductID
+		action.Index.RequireAlias = item.requireAlias
+		if item.product.Version > 0 || item.backfill {
+			version := item.product.Version
+			action.Index.Version = &version
+			action.Index.VersionType = "external"
+		}
+		if err := enc.Encode(action); err != nil {
+			return nil, fmt.Errorf("failed to encode bulk action: %w", err)
+		}
+		if err := enc.Encode(productDocument{Product: item.product}); err != nil {
+			return nil, fmt.Errorf("failed to marshal product for Elasticsearch: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// bulk writes items in a single _bulk request and returns their results in order
+func (s *ElasticsearchIndex) bulk(ctx context.Context, items []bulkItem) ([]bulkResult, error) {
+	body, err := encodeBulk(items)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Bulk(bytes.NewReader(body), s.client.Bulk.WithContext(ctx))
+	if err != nil {
+		return nil, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, mapResponseError(res)
+	}
+
+	var response struct {
+		Items []map[string]bulkResult `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if len(response.Items) != len(items) {
+		return nil, fmt.Errorf("bulk response has %d results for %d items", len(response.Items), len(items))
+	}
+	results := make([]bulkResult, len(items))
+	for i, item := range response.Items {
+		results[i] = item["index"]
+	}
+	return results, nil
+}
+
+// bulkIndex backfills index with products. Documents skipped because the same or a newer
+// version is already indexed are not failures.
+func (s *ElasticsearchIndex) bulkIndex(ctx context.Context, index string, products []models.Product) error {
+	items := make([]bulkItem, len(products))
+	for i, product := range products {
+		items[i] = bulkItem{index: index, backfill: true, product: product}
+	}
+	results, err := s.bulk(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	var first error
+	for _, result := range results {
+		if result.ok() {
+			continue
+		}
+		failed++
+		if first == nil {
+			first = result.err()
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d products failed to index, first %w", failed, len(products), first)
+}
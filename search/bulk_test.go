@@ -0,0 +1,105 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"query-service/models"
+	"strconv"
+	"testing"
+)
+
+func TestEncodeBulkVersions(t *testing.T) {
+	tests := []struct {
+		name            string
+		item            bulkItem
+		wantVersion     *int64
+		wantVersionType string
+	}{
+		{
+			name:            "versioned",
+			item:            bulkItem{index: "products", product: models.Product{ProductID: "p1", Version: 7}},
+			wantVersion:     ptr(int64(7)),
+			wantVersionType: "external",
+		},
+		{
+			name: "unversioned overwrites",
+			item: bulkItem{index: "products", product: models.Product{ProductID: "p1"}},
+		},
+		{
+			name:            "unversioned backfill only creates",
+			item:            bulkItem{index: "products", backfill: true, product: models.Product{ProductID: "p1"}},
+			wantVersion:     ptr(int64(0)),
+			wantVersionType: "external",
+		},
+		{
+			name:            "versioned backfill",
+			item:            bulkItem{index: "products", backfill: true, product: models.Product{ProductID: "p1", Version: 3}},
+			wantVersion:     ptr(int64(3)),
+			wantVersionType: "external",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := encodeBulk([]bulkItem{tt.item})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.Split(bytes.TrimSuffix(body, []byte("\n")), []byte("\n"))
+			if len(lines) != 2 {
+				t.Fatalf("got %d lines, want an action and a document:\n%s", len(lines), body)
+			}
+
+			var action struct {
+				Index map[string]json.RawMessage `json:"index"`
+			}
+			if err := json.Unmarshal(lines[0], &action); err != nil {
+				t.Fatal(err)
+			}
+			if id := string(action.Index["_id"]); id != `"p1"` {
+				t.Errorf("_id %s, want \"p1\"", id)
+			}
+			version, hasVersion := action.Index["version"]
+			switch {
+			case tt.wantVersion == nil && hasVersion:
+				t.Errorf("action %s has a version, want none", lines[0])
+			case tt.wantVersion != nil && string(version) != strconv.FormatInt(*tt.wantVersion, 10):
+				t.Errorf("action %s, want version %d", lines[0], *tt.wantVersion)
+			}
+			versionType := ""
+			if raw, ok := action.Index["version_type"]; ok {
+				if err := json.Unmarshal(raw, &versionType); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if versionType != tt.wantVersionType {
+				t.Errorf("version_type %q, want %q", versionType, tt.wantVersionType)
+			}
+		})
+	}
+}
+
+func TestBulkResultOK(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusCreated, true},
+		// The same or a newer version is indexed already
+		{http.StatusConflict, true},
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		if got := (bulkResult{Status: tt.status}).ok(); got != tt.want {
+			t.Errorf("status %d: ok() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
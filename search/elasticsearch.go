@@ -0,0 +1,306 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"query-service/apperror"
+	"query-service/logging"
+	"query-service/models"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ElasticsearchIndex implements SearchIndex on an Elasticsearch index or alias
+type ElasticsearchIndex struct {
+	client *elasticsearch.Client
+	index  string
+}
+
+// NewElasticsearchIndex creates a SearchIndex for the named index or alias
+func NewElasticsearchIndex(client *elasticsearch.Client, index string) *ElasticsearchIndex {
+	return &ElasticsearchIndex{client: client, index: index}
+}
+
+// rebuildAlias names the alias on an index being rebuilt by a reindex. Every write goes
+// to it as well while it exists, so the new index misses no change made during the rebuild.
+func (s *ElasticsearchIndex) rebuildAlias() string {
+	return s.index + "_reindex"
+}
+
+// productDocument is the indexed form of a product. The Mongo ObjectID is left out since
+// _id is a metadata field Elasticsearch rejects inside a document.
+type productDocument struct {
+	models.Product
+	ID *struct{} `json:"_id,omitempty"`
+}
+
+// IndexProduct writes the product to the index and, in the same request, to an index
+// being rebuilt if there is one. External versioning makes Elasticsearch skip writes older
+// than the indexed document.
+func (s *ElasticsearchIndex) IndexProduct(ctx context.Context, product models.Product) error {
+	results, err := s.bulk(ctx, []bulkItem{
+		{index: s.index, product: product},
+		{index: s.rebuildAlias(), requireAlias: true, product: product},
+	})
+	if err != nil {
+		return err
+	}
+	if written := results[0]; !written.ok() {
+		return fmt.Errorf("Elasticsearch error: %w", written.err())
+	}
+	// Not found means no rebuild is running
+	if mirrored := results[1]; !mirrored.ok() && mirrored.Status != http.StatusNotFound {
+		return fmt.Errorf("failed to write to the index being rebuilt: %w", mirrored.err())
+	}
+	return nil
+}
+
+func (s *ElasticsearchIndex) Search(ctx context.Context, query Query) (Result, error) {
+	// Serialize the query to JSON
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchBody(query)); err != nil {
+		return Result{}, fmt.Errorf("failed to encode search query: %w", err)
+	}
+
+	// Perform the search request
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(s.index),
+		s.client.Search.WithBody(&buf),
+		s.client.Search.WithTrackTotalHits(true),
+	)
+	if err != nil {
+		return Result{}, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return Result{}, mapResponseError(res)
+	}
+
+	// Parse the response
+	var response searchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return Result{}, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	result := response.result()
+
+	// Offer a corrected query when nothing matched, but still return the empty result if
+	// that fails
+	if result.Total == 0 && query.Text != "" {
+		didYouMean, err := s.didYouMean(ctx, query)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to suggest a corrected query", logging.Err(err))
+		}
+		result.DidYouMean = didYouMean
+	}
+	return result, nil
+}
+
+// searchFields are the fields the search text is matched against, with their boosts
+var searchFields = []string{"name^3", "description", "category.name^2"}
+
+// searchBody builds the search request: a typo-tolerant multi_match on the text (or
+// match_all when it is empty), the set filters, highlighting and the facet aggregations
+func searchBody(query Query) map[string]interface{} {
+	must := []interface{}{map[string]interface{}{"match_all": map[string]interface{}{}}}
+	if query.Text != "" {
+		must = []interface{}{map[string]interface{}{"multi_match": map[string]interface{}{
+			"query":     query.Text,
+			"fields":    searchFields,
+			"fuzziness": "AUTO",
+			// Typos in the first letter are left to the did-you-mean suggestion, which keeps
+			// fuzzy matching cheap and avoids matching unrelated words
+			"prefix_length": 1,
+		}}}
+	}
+
+	filter := searchFilters(query)
+
+	priceRanges := []interface{}{map[string]interface{}{"to": priceBreaks[0]}}
+	for i := 1; i < len(priceBreaks); i++ {
+		priceRanges = append(priceRanges, map[string]interface{}{"from": priceBreaks[i-1], "to": priceBreaks[i]})
+	}
+	priceRanges = append(priceRanges, map[string]interface{}{"from": priceBreaks[len(priceBreaks)-1]})
+
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"must": must, "filter": filter},
+		},
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{"<em>"},
+			"post_tags": []string{"</em>"},
+			"fields": map[string]interface{}{
+				"name":        map[string]interface{}{"number_of_fragments": 0},
+				"description": map[string]interface{}{"fragment_size": 150, "number_of_fragments": 3},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"categories": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "category.id", "size": facetSize},
+				"aggs": map[string]interface{}{
+					"name": map[string]interface{}{"terms": map[string]interface{}{"field": "category.name.keyword", "size": 1}},
+				},
+			},
+			"prices": map[string]interface{}{
+				"range": map[string]interface{}{"field": "price", "ranges": priceRanges},
+			},
+			"attributes": map[string]interface{}{
+				"nested": map[string]interface{}{"path": "attributes"},
+				"aggs": map[string]interface{}{
+					"names": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "attributes.name", "size": facetSize},
+						"aggs": map[string]interface{}{
+							"values": map[string]interface{}{"terms": map[string]interface{}{"field": "attributes.value", "size": facetSize}},
+						},
+					},
+				},
+			},
+		},
+		"from": query.From,
+		"size": query.Size,
+	}
+}
+
+// searchFilters builds the filter clauses for every filter set on the query
+func searchFilters(query Query) []interface{} {
+	filter := []interface{}{}
+	if query.CategoryID != "" {
+		filter = append(filter, term("category.id", query.CategoryID))
+	}
+	if query.ParentCategoryID != "" {
+		filter = append(filter, term("category.parentCategory.id", query.ParentCategoryID))
+	}
+	if query.MinPrice != nil || query.MaxPrice != nil {
+		price := map[string]interface{}{}
+		if query.MinPrice != nil {
+			price["gte"] = *query.MinPrice
+		}
+		if query.MaxPrice != nil {
+			price["lte"] = *query.MaxPrice
+		}
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"price": price}})
+	}
+	if query.InStock {
+		filter = append(filter, map[string]interface{}{"range": map[string]interface{}{"currentInventory": map[string]interface{}{"gt": 0}}})
+	}
+	// Attributes are nested so each name/value pair is matched within a single attribute
+	for _, attr := range query.Attributes {
+		filter = append(filter, map[string]interface{}{"nested": map[string]interface{}{
+			"path": "attributes",
+			"query": map[string]interface{}{"bool": map[string]interface{}{"filter": []interface{}{
+				term("attributes.name", attr.Name),
+				term("attributes.value", attr.Value),
+			}}},
+		}})
+	}
+	return filter
+}
+
+func term(field, value string) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+// searchResponse is the part of an Elasticsearch search response the service reads
+type searchResponse struct {
+	Hits struct {
+		Total struct {
+			Value int64 `json:"value"`
+		} `json:"total"`
+		Hits []struct {
+			Score     float64             `json:"_score"`
+			Source    models.Product      `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+		} `json:"hits"`
+	} `json:"hits"`
+	Aggregations struct {
+		Categories struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int64  `json:"doc_count"`
+				Name     struct {
+					Buckets []struct {
+						Key string `json:"key"`
+					} `json:"buckets"`
+				} `json:"name"`
+			} `json:"buckets"`
+		} `json:"categories"`
+		Prices struct {
+			Buckets []struct {
+				From     *float64 `json:"from"`
+				To       *float64 `json:"to"`
+				DocCount int64    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"prices"`
+		Attributes struct {
+			Names struct {
+				Buckets []struct {
+					Key    string `json:"key"`
+					Values struct {
+						Buckets []struct {
+							Key      string `json:"key"`
+							DocCount int64  `json:"doc_count"`
+						} `json:"buckets"`
+					} `json:"values"`
+				} `json:"buckets"`
+			} `json:"names"`
+		} `json:"attributes"`
+	} `json:"aggregations"`
+}
+
+func (r searchResponse) result() Result {
+	result := Result{
+		Total: r.Hits.Total.Value,
+		Hits:  make([]Hit, 0, len(r.Hits.Hits)),
+		Facets: Facets{
+			Categories: []Bucket{},
+			Prices:     []PriceBucket{},
+			Attributes: []AttributeFacet{},
+		},
+	}
+	for _, hit := range r.Hits.Hits {
+		result.Hits = append(result.Hits, Hit{Product: hit.Source, Score: hit.Score, Highlights: hit.Highlight})
+	}
+
+	aggs := r.Aggregations
+	for _, bucket := range aggs.Categories.Buckets {
+		category := Bucket{Value: bucket.Key, Count: bucket.DocCount}
+		if len(bucket.Name.Buckets) > 0 {
+			category.Label = bucket.Name.Buckets[0].Key
+		}
+		result.Facets.Categories = append(result.Facets.Categories, category)
+	}
+	for _, bucket := range aggs.Prices.Buckets {
+		result.Facets.Prices = append(result.Facets.Prices, PriceBucket{From: bucket.From, To: bucket.To, Count: bucket.DocCount})
+	}
+	for _, name := range aggs.Attributes.Names.Buckets {
+		facet := AttributeFacet{Name: name.Key, Values: []Bucket{}}
+		for _, value := range name.Values.Buckets {
+			facet.Values = append(facet.Values, Bucket{Value: value.Key, Count: value.DocCount})
+		}
+		result.Facets.Attributes = append(result.Facets.Attributes, facet)
+	}
+	return result
+}
+
+// mapTransportError classifies a request that never got a response
+func mapTransportError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apperror.Timeout("search did not respond in time", err)
+	}
+	return apperror.Unavailable("search is unavailable", err)
+}
+
+// mapResponseError classifies an error response: overload and server errors are reported
+// as unavailable, anything else means the request itself was rejected
+func mapResponseError(res *esapi.Response) error {
+	err := fmt.Errorf("Elasticsearch error: %s", res.String())
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return apperror.Unavailable("search is unavailable", err)
+	}
+	return apperror.Internal("search request failed", err)
+}
@@ -0,0 +1,309 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"query-service/apperror"
+	"query-service/config"
+	"query-service/logging"
+	"query-service/models"
+	"query-service/repository"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// errNoIndex is returned when neither an alias nor an index carries the products alias name
+var errNoIndex = apperror.NotFound("the product search index does not exist")
+
+// ProductSource streams every stored product in ID order, starting after afterID
+type ProductSource interface {
+	Scan(ctx context.Context, afterID string, fn func(models.Product) error) error
+	Count(ctx context.Context) (int64, error)
+}
+
+// IndexState describes the index behind the products alias and how its mapping differs
+// from the one this build expects
+type IndexState struct {
+	Alias string `json:"alias"`
+	Index string `json:"index"`
+	// Legacy is set when the alias name is a concrete index created before indices were versioned
+	Legacy bool `json:"legacy"`
+	// Version is the mapping version of the index, 0 when it is legacy
+	Version int `json:"version"`
+	// Rebuilding is the index an unfinished reindex is filling, if any
+	Rebuilding      string        `json:"rebuilding,omitempty"`
+	ExpectedVersion int           `json:"expectedVersion"`
+	Diffs           []MappingDiff `json:"diffs"`
+	// UpToDate is set when the index is versioned and its mapping has no differences
+	UpToDate bool `json:"upToDate"`
+}
+
+// Outdated reports whether the index is legacy or of an earlier mapping version, so it
+// lacks fields and analyzers this build relies on. An index of a later version, as during
+// a rolling deployment, is not outdated.
+func (s IndexState) Outdated() bool {
+	return s.Legacy || s.Version < s.ExpectedVersion
+}
+
+// IndexManager keeps the products alias pointing at a versioned index with the expected
+// mapping, and rebuilds that index from the product store on request.
+//
+// A reindex creates a new index from the template behind the rebuild alias, which every
+// IndexProduct call writes to as well, and copies every product into it. It then moves
+// the alias to it and drops the old index in a single atomic _aliases request, so searches
+// never see a partial index. Progress is checkpointed after every batch so an interrupted
+// reindex resumes where it stopped. A lock stored with the checkpoint keeps replicas and
+// the reindex subcommand from rebuilding at the same time.
+type IndexManager struct {
+	client      *elasticsearch.Client
+	index       *ElasticsearchIndex
+	products    ProductSource
+	checkpoints repository.CheckpointStore
+	cfg         config.ReindexConfig
+	// owner identifies this process as the holder of the reindex lock
+	owner string
+	// afterBatch is called with every batch once it is indexed
+	afterBatch func(ctx context.Context, products []models.Product)
+
+	// ctx is cancelled by Close to stop a reindex started with StartReindex
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	status ReindexStatus
+	// done is closed when the running reindex returns
+	done chan struct{}
+}
+
+// NewIndexManager manages the alias index writes to, rebuilding it from products and
+// keeping reindex checkpoints in checkpoints
+func NewIndexManager(index *ElasticsearchIndex, products ProductSource, checkpoints repository.CheckpointStore,
+	cfg config.ReindexConfig) *IndexManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &IndexManager{
+		client:      index.client,
+		index:       index,
+		products:    products,
+		checkpoints: checkpoints,
+		cfg:         cfg,
+		owner:       newLockOwner(),
+		ctx:         ctx,
+		cancel:      cancel,
+		status:      ReindexStatus{State: ReindexIdle},
+	}
+}
+
+// newLockOwner identifies this process by host, process ID and a random suffix
+func newLockOwner() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s/%d/%x", host, os.Getpid(), suffix)
+}
+
+// SetBatchHook registers fn to be called with every batch a reindex has indexed, such as
+// to drop cached copies of the products
+func (m *IndexManager) SetBatchHook(fn func(ctx context.Context, products []models.Product)) {
+	m.afterBatch = fn
+}
+
+// Ensure installs the index template and, when the alias doesn't exist yet, creates the
+// first index of the current version behind it. It returns the state of the deployed index.
+func (m *IndexManager) Ensure(ctx context.Context) (IndexState, error) {
+	if err := m.putTemplate(ctx); err != nil {
+		return IndexState{}, err
+	}
+	state, err := m.Check(ctx)
+	if !errors.Is(err, errNoIndex) {
+		return state, err
+	}
+
+	aliases := map[string]interface{}{m.index.index: map[string]interface{}{"is_write_index": true}}
+	if err := m.createIndex(ctx, ProductsIndexPrefix(), aliases); err != nil {
+		// Another replica may have created it first
+		if state, checkErr := m.Check(ctx); checkErr == nil {
+			return state, nil
+		}
+		return IndexState{}, err
+	}
+	slog.Info("created product search index", slog.String(logging.KeyIndex, ProductsIndexPrefix()))
+	return m.Check(ctx)
+}
+
+// Check compares the mapping of the index behind the alias with the expected one
+func (m *IndexManager) Check(ctx context.Context) (IndexState, error) {
+	index, legacy, err := m.resolve(ctx)
+	if err != nil {
+		return IndexState{}, err
+	}
+	rebuilding, err := m.aliasTarget(ctx, m.index.rebuildAlias())
+	if err != nil {
+		return IndexState{}, err
+	}
+	deployed, err := m.mapping(ctx, index)
+	if err != nil {
+		return IndexState{}, err
+	}
+	diffs := diffMappings(productMappings(), deployed)
+	if diffs == nil {
+		diffs = []MappingDiff{}
+	}
+	return IndexState{
+		Alias:           m.index.index,
+		Index:           index,
+		Legacy:          legacy,
+		Version:         productsIndexVersion(index),
+		Rebuilding:      rebuilding,
+		ExpectedVersion: ProductsIndexVersion,
+		Diffs:           diffs,
+		UpToDate:        !legacy && len(diffs) == 0,
+	}, nil
+}
+
+// resolve returns the index the alias sends writes to. legacy is set when the alias name
+// is a concrete index instead.
+func (m *IndexManager) resolve(ctx context.Context) (index string, legacy bool, err error) {
+	alias := m.index.index
+	index, err = m.aliasTarget(ctx, alias)
+	if err != nil || index != "" {
+		return index, false, err
+	}
+
+	res, err := m.client.Indices.Exists([]string{alias}, m.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return "", false, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return "", false, errNoIndex
+	case res.IsError():
+		return "", false, mapResponseError(res)
+	default:
+		return alias, true, nil
+	}
+}
+
+// aliasTarget returns the write index of alias, or "" when there is no such alias
+func (m *IndexManager) aliasTarget(ctx context.Context, alias string) (string, error) {
+	res, err := m.client.Indices.GetAlias(
+		m.client.Indices.GetAlias.WithContext(ctx),
+		m.client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return "", mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if res.IsError() {
+		return "", mapResponseError(res)
+	}
+
+	var indices map[string]struct {
+		Aliases map[string]struct {
+			IsWriteIndex bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return "", fmt.Errorf("failed to parse alias response: %w", err)
+	}
+	for name, entry := range indices {
+		if entry.Aliases[alias].IsWriteIndex || len(indices) == 1 {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("alias %s points at %d indices and none is the write index", alias, len(indices))
+}
+
+// mapping returns the deployed mapping of index
+func (m *IndexManager) mapping(ctx context.Context, index string) (map[string]interface{}, error) {
+	res, err := m.client.Indices.GetMapping(
+		m.client.Indices.GetMapping.WithContext(ctx),
+		m.client.Indices.GetMapping.WithIndex(index),
+	)
+	if err != nil {
+		return nil, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, mapResponseError(res)
+	}
+
+	var indices map[string]struct {
+		Mappings map[string]interface{} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("failed to parse mapping response: %w", err)
+	}
+	return indices[index].Mappings, nil
+}
+
+func (m *IndexManager) putTemplate(ctx context.Context) error {
+	body, _ := json.Marshal(productsTemplateBody())
+	res, err := m.client.Indices.PutIndexTemplate(productsTemplate, bytes.NewReader(body),
+		m.client.Indices.PutIndexTemplate.WithContext(ctx),
+	)
+	if err != nil {
+		return mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return mapResponseError(res)
+	}
+	return nil
+}
+
+// createIndex creates an index with the given aliases that takes its settings and mappings
+// from the template
+func (m *IndexManager) createIndex(ctx context.Context, index string, aliases map[string]interface{}) error {
+	raw, _ := json.Marshal(map[string]interface{}{"aliases": aliases})
+	res, err := m.client.Indices.Create(index,
+		m.client.Indices.Create.WithContext(ctx),
+		m.client.Indices.Create.WithBody(bytes.NewReader(raw)),
+	)
+	if err != nil {
+		return mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return mapResponseError(res)
+	}
+	return nil
+}
+
+func (m *IndexManager) refresh(ctx context.Context, index string) error {
+	res, err := m.client.Indices.Refresh(
+		m.client.Indices.Refresh.WithContext(ctx),
+		m.client.Indices.Refresh.WithIndex(index),
+	)
+	if err != nil {
+		return mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return mapResponseError(res)
+	}
+	return nil
+}
+
+func (m *IndexManager) deleteIndex(ctx context.Context, index string) error {
+	res, err := m.client.Indices.Delete([]string{index}, m.client.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return mapResponseError(res)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProductsAlias is the read/write alias every product search and write goes through
+const ProductsAlias = "products"
+
+// ProductsIndexVersion is bumped whenever productMappings changes incompatibly, so a
+// deployment with the new mapping builds a fresh index instead of writing to the old one
+const ProductsIndexVersion = 4
+
+// SynonymsPath is the synonyms file read by every Elasticsearch node, relative to its config directory
+const SynonymsPath = "analysis/product_synonyms.txt"
+
+// productsTemplate is the index template that applies the settings and mappings to every
+// products index of the current version
+const productsTemplate = "products"
+
+// ProductsIndexPrefix names the indices of the current mapping version, e.g. products_v2
+func ProductsIndexPrefix() string {
+	return ProductsAlias + "_v" + strconv.Itoa(ProductsIndexVersion)
+}
+
+// productsIndexVersion returns the mapping version in the name of a products index, or 0
+// when the name carries none, as for a legacy index
+func productsIndexVersion(index string) int {
+	rest, ok := strings.CutPrefix(index, ProductsAlias+"_v")
+	if !ok {
+		return 0
+	}
+	digits, _, _ := strings.Cut(rest, "_")
+	version, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+// newProductsIndexName names a fresh index for a reindex, e.g. products_v2_20240101t120000123
+func newProductsIndexName(now time.Time) string {
+	now = now.UTC()
+	return fmt.Sprintf("%s_%s%03d", ProductsIndexPrefix(), now.Format("20060102t150405"), now.Nanosecond()/int(time.Millisecond))
+}
+
+// productSettings configures the analyzers used by productMappings
+func productSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"analyzer": map[string]interface{}{
+				"custom_analyzer": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding"},
+				},
+				// Expands synonyms at search time only, so changing them needs a reload of the
+				// search analyzers instead of a reindex
+				"custom_search_analyzer": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding", "product_synonyms"},
+				},
+				// Indexes every prefix of each word so a partly typed word matches; queries
+				// use custom_analyzer so the typed prefix itself isn't split up
+				"autocomplete_analyzer": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding", "autocomplete_filter"},
+				},
+			},
+			"filter": map[string]interface{}{
+				"product_synonyms": map[string]interface{}{
+					"type":          "synonym_graph",
+					"synonyms_path": SynonymsPath,
+					"updateable":    true,
+				},
+				"autocomplete_filter": map[string]interface{}{
+					"type":     "edge_ngram",
+					"min_gram": 1,
+					"max_gram": 20,
+				},
+			},
+		},
+	}
+}
+
+// productMappings is the expected mapping of a products index
+func productMappings() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+	text := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        "custom_analyzer",
+		"search_analyzer": "custom_search_analyzer",
+	}
+	// suggest subfields back the type-ahead suggestions
+	suggest := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        "autocomplete_analyzer",
+		"search_analyzer": "custom_analyzer",
+	}
+
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"productId": keyword,
+			"sku":       keyword,
+			"name": map[string]interface{}{
+				"type":            "text",
+				"analyzer":        "custom_analyzer",
+				"search_analyzer": "custom_search_analyzer",
+				"fields":          map[string]interface{}{"suggest": suggest},
+			},
+			"description": text,
+			// Category IDs are filtered and aggregated on; the name is searched and used as the facet label
+			"category": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"id": keyword,
+					"name": map[string]interface{}{
+						"type":            "text",
+						"analyzer":        "custom_analyzer",
+						"search_analyzer": "custom_search_analyzer",
+						"fields":          map[string]interface{}{"keyword": keyword, "suggest": suggest},
+					},
+					"parentCategory": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"id":   keyword,
+							"name": keyword,
+						},
+					},
+				},
+			},
+			"price":            map[string]interface{}{"type": "double"},
+			"currentInventory": map[string]interface{}{"type": "integer"},
+			"images":           map[string]interface{}{"type": "keyword", "index": false},
+			// Nested so an attribute filter matches a name and value of the same attribute
+			"attributes": map[string]interface{}{
+				"type": "nested",
+				"properties": map[string]interface{}{
+					"name":  keyword,
+					"value": keyword,
+				},
+			},
+			"version": map[string]interface{}{"type": "long"},
+			"created": map[string]interface{}{"type": "date"},
+			"updated": map[string]interface{}{"type": "date"},
+		},
+	}
+}
+
+// productsTemplateBody is the index template for every index of the current version
+func productsTemplateBody() map[string]interface{} {
+	return map[string]interface{}{
+		"index_patterns": []string{ProductsIndexPrefix() + "*"},
+		"template": map[string]interface{}{
+			"settings": productSettings(),
+			"mappings": productMappings(),
+		},
+		"_meta": map[string]interface{}{"version": ProductsIndexVersion},
+	}
+}
+
+// MappingDiff describes one field whose deployed mapping differs from the expected one
+type MappingDiff struct {
+	Field    string      `json:"field"`
+	Expected interface{} `json:"expected"`
+	Deployed interface{} `json:"deployed"`
+}
+
+func (d MappingDiff) String() string {
+	return fmt.Sprintf("%s: expected %v, deployed %v", d.Field, d.Expected, d.Deployed)
+}
+
+// diffMappings compares every expected field with the deployed mapping. Fields the
+// deployed mapping has in addition, such as dynamically mapped ones, are ignored.
+func diffMappings(expected, deployed map[string]interface{}) []MappingDiff {
+	// Round-trip through JSON so both sides use the same Go types
+	normalize := func(m map[string]interface{}) map[string]interface{} {
+		raw, _ := json.Marshal(m)
+		var out map[string]interface{}
+		_ = json.Unmarshal(raw, &out)
+		return out
+	}
+	var diffs []MappingDiff
+	diffProperties("", properties(normalize(expected)), properties(normalize(deployed)), &diffs)
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+func diffProperties(prefix string, expected, deployed map[string]interface{}, diffs *[]MappingDiff) {
+	for name, want := range expected {
+		field := prefix + name
+		wantField, _ := want.(map[string]interface{})
+		gotField, ok := deployed[name].(map[string]interface{})
+		if !ok {
+			*diffs = append(*diffs, MappingDiff{Field: field, Expected: fieldType(wantField), Deployed: "missing"})
+			continue
+		}
+		if fieldType(wantField) != fieldType(gotField) {
+			*diffs = append(*diffs, MappingDiff{Field: field, Expected: fieldType(wantField), Deployed: fieldType(gotField)})
+			continue
+		}
+		for _, setting := range []string{"analyzer", "search_analyzer", "index", "fields"} {
+			if wantValue, set := wantField[setting]; set && !reflect.DeepEqual(wantValue, gotField[setting]) {
+				*diffs = append(*diffs, MappingDiff{Field: field + "." + setting, Expected: wantValue, Deployed: gotField[setting]})
+			}
+		}
+		if wantProps := properties(wantField); len(wantProps) > 0 {
+			diffProperties(field+".", wantProps, properties(gotField), diffs)
+		}
+	}
+}
+
+// fieldType is a field's mapping type; fields with only properties are objects
+func fieldType(field map[string]interface{}) string {
+	if t, ok := field["type"].(string); ok {
+		return t
+	}
+	return "object"
+}
+
+func properties(m map[string]interface{}) map[string]interface{} {
+	props, _ := m["properties"].(map[string]interface{})
+	return props
+}
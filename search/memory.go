@@ -0,0 +1,334 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"query-service/models"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryIndex is an in-process SearchIndex for tests and local runs.
+// It matches any query term against name, description and category name, allowing typos
+// within the AUTO fuzziness, applies the same filters as the Elasticsearch query and
+// computes facets and highlights by hand. Synonyms are not expanded.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	products []models.Product
+}
+
+// NewMemoryIndex creates an empty in-memory search index
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{}
+}
+
+func (s *MemoryIndex) IndexProduct(ctx context.Context, product models.Product) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.products {
+		if s.products[i].ProductID == product.ProductID {
+			// Mirror external versioning: keep the indexed document if it is newer
+			if product.Version == 0 || product.Version > s.products[i].Version {
+				s.products[i] = product
+			}
+			return nil
+		}
+	}
+	s.products = append(s.products, product)
+	return nil
+}
+
+func (s *MemoryIndex) Search(ctx context.Context, query Query) (Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := strings.Fields(strings.ToLower(query.Text))
+	var matched []models.Product
+	for _, product := range s.products {
+		if matchesFilters(product, query) && (len(terms) == 0 || matchesAny(product, terms)) {
+			matched = append(matched, product)
+		}
+	}
+
+	result := Result{Total: int64(len(matched)), Hits: []Hit{}, Facets: facets(matched)}
+	if len(matched) == 0 && len(terms) > 0 {
+		result.DidYouMean = s.didYouMean(query, terms)
+	}
+	for i := query.From; i >= 0 && i < len(matched) && len(result.Hits) < query.Size; i++ {
+		hit := Hit{Product: matched[i], Score: 1}
+		if name := highlight(matched[i].Name, terms); name != "" {
+			hit.Highlights = map[string][]string{"name": {name}}
+		}
+		if description := highlight(matched[i].Description, terms); description != "" {
+			if hit.Highlights == nil {
+				hit.Highlights = map[string][]string{}
+			}
+			hit.Highlights["description"] = []string{description}
+		}
+		result.Hits = append(result.Hits, hit)
+	}
+	return result, nil
+}
+
+// Suggest matches every typed word as a prefix of a word in the name or category name,
+// scoring name matches above category matches like the Elasticsearch field boosts
+func (s *MemoryIndex) Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := strings.Fields(strings.ToLower(query.Text))
+	suggestions := []Suggestion{}
+	if len(terms) == 0 {
+		return suggestions, nil
+	}
+	for _, product := range s.products {
+		if score := prefixScore(product, terms); score > 0 {
+			suggestions = append(suggestions, newSuggestion(product, score))
+		}
+	}
+	return rankSuggestions(suggestions, query), nil
+}
+
+// prefixScore scores 3 for every term prefixing a word of the name and 1 for every other
+// term prefixing a word of the category name, or 0 when any term prefixes neither
+func prefixScore(product models.Product, terms []string) float64 {
+	name := strings.Fields(strings.ToLower(product.Name))
+	category := strings.Fields(strings.ToLower(product.Category.Name))
+	hasPrefix := func(words []string, term string) bool {
+		return slices.ContainsFunc(words, func(word string) bool { return strings.HasPrefix(word, term) })
+	}
+
+	var score float64
+	for _, term := range terms {
+		switch {
+		case hasPrefix(name, term):
+			score += 3
+		case hasPrefix(category, term):
+			score++
+		default:
+			return 0
+		}
+	}
+	return score
+}
+
+// matchesFilters reports whether the product passes every filter set on the query
+func matchesFilters(product models.Product, query Query) bool {
+	switch {
+	case query.CategoryID != "" && product.Category.ID != query.CategoryID:
+		return false
+	case query.ParentCategoryID != "" && product.Category.ParentCategory.ID != query.ParentCategoryID:
+		return false
+	case query.MinPrice != nil && product.Price < *query.MinPrice:
+		return false
+	case query.MaxPrice != nil && product.Price > *query.MaxPrice:
+		return false
+	case query.InStock && product.CurrentInventory <= 0:
+		return false
+	}
+	for _, want := range query.Attributes {
+		if !slices.Contains(product.Attributes, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny reports whether any term appears in the product's searchable fields
+func matchesAny(product models.Product, terms []string) bool {
+	text := strings.ToLower(product.Name + " " + product.Description + " " + product.Category.Name)
+	words := strings.Fields(text)
+	for _, term := range terms {
+		// Like the Elasticsearch query, fuzzy matches must get the first letter right
+		fuzzy := func(word string) bool { return word[0] == term[0] && fuzzyMatch(word, term) }
+		if strings.Contains(text, term) || slices.ContainsFunc(words, fuzzy) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyMatch reports whether word is within the AUTO fuzziness of term: no edits for
+// terms of up to 2 characters, one for up to 5 and two for longer ones
+func fuzzyMatch(word, term string) bool {
+	maxEdits := 2
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		maxEdits = 0
+	case n <= 5:
+		maxEdits = 1
+	}
+	return editDistance(word, term) <= maxEdits
+}
+
+// editDistance counts the insertions, deletions, substitutions and transpositions of
+// adjacent characters that turn a into b
+func editDistance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	// Three rows of the distance matrix are enough to allow transpositions
+	prev2 := make([]int, len(y)+1)
+	prev := make([]int, len(y)+1)
+	cur := make([]int, len(y)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		cur[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(y)]
+}
+
+// didYouMean replaces every term with the closest word, within the AUTO fuzziness, of the
+// name or description of a product passing the query's filters. It returns "" when no term
+// can be corrected.
+func (s *MemoryIndex) didYouMean(query Query, terms []string) string {
+	var vocabulary []string
+	for _, product := range s.products {
+		if matchesFilters(product, query) {
+			vocabulary = append(vocabulary, strings.Fields(strings.ToLower(product.Name+" "+product.Description))...)
+		}
+	}
+
+	corrected := slices.Clone(terms)
+	changed := false
+	for i, term := range terms {
+		best := -1
+		for _, word := range vocabulary {
+			if word == term {
+				best = -1
+				break
+			}
+			if d := editDistance(word, term); fuzzyMatch(word, term) && (best < 0 || d < best) {
+				best = d
+				corrected[i] = word
+			}
+		}
+		if best < 0 {
+			corrected[i] = term
+		} else {
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(corrected, " ")
+}
+
+// highlight wraps every occurrence of the terms in text in <em> tags, or returns "" when
+// none occurs
+func highlight(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Lowercasing changed byte offsets; skip highlighting rather than misplace tags
+		return ""
+	}
+	marked := make([]bool, len(text))
+	found := false
+	for _, term := range terms {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], term)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(term); k++ {
+				marked[k] = true
+			}
+			found = true
+			i += j + len(term)
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := range text {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString("<em>")
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString("</em>")
+		}
+	}
+	return b.String()
+}
+
+// facets counts the matches per category, price range and attribute value, ordered by
+// descending count like Elasticsearch's terms aggregation
+func facets(products []models.Product) Facets {
+	categories := map[string]*Bucket{}
+	attributes := map[string]map[string]int64{}
+	prices := make([]PriceBucket, len(priceBreaks)+1)
+	for i := range prices {
+		if i > 0 {
+			prices[i].From = &priceBreaks[i-1]
+		}
+		if i < len(priceBreaks) {
+			prices[i].To = &priceBreaks[i]
+		}
+	}
+
+	for _, product := range products {
+		if category, ok := categories[product.Category.ID]; ok {
+			category.Count++
+		} else {
+			categories[product.Category.ID] = &Bucket{Value: product.Category.ID, Label: product.Category.Name, Count: 1}
+		}
+		prices[sort.Search(len(priceBreaks), func(i int) bool { return priceBreaks[i] > product.Price })].Count++
+		for _, attr := range product.Attributes {
+			if attributes[attr.Name] == nil {
+				attributes[attr.Name] = map[string]int64{}
+			}
+			attributes[attr.Name][attr.Value]++
+		}
+	}
+
+	result := Facets{Categories: []Bucket{}, Prices: prices, Attributes: []AttributeFacet{}}
+	for _, category := range categories {
+		result.Categories = append(result.Categories, *category)
+	}
+	result.Categories = topBuckets(result.Categories)
+	for name, values := range attributes {
+		facet := AttributeFacet{Name: name, Values: []Bucket{}}
+		for value, count := range values {
+			facet.Values = append(facet.Values, Bucket{Value: value, Count: count})
+		}
+		facet.Values = topBuckets(facet.Values)
+		result.Attributes = append(result.Attributes, facet)
+	}
+	slices.SortFunc(result.Attributes, func(a, b AttributeFacet) int { return strings.Compare(a.Name, b.Name) })
+	if len(result.Attributes) > facetSize {
+		result.Attributes = result.Attributes[:facetSize]
+	}
+	return result
+}
+
+// topBuckets orders buckets by descending count, then value, and keeps the first facetSize
+func topBuckets(buckets []Bucket) []Bucket {
+	slices.SortFunc(buckets, func(a, b Bucket) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	if len(buckets) > facetSize {
+		buckets = buckets[:facetSize]
+	}
+	return buckets
+}
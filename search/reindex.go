@@ -0,0 +1,477 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"query-service/apperror"
+	"query-service/logging"
+	"query-service/models"
+	"query-service/repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reindexLockTTL is how long the reindex lock holds without being renewed. It is renewed
+// every third of that while a reindex runs.
+const reindexLockTTL = time.Minute
+
+// unlockTimeout bounds releasing the reindex lock once a reindex returns
+const unlockTimeout = 5 * time.Second
+
+// errLockLost stops a reindex whose lock was taken over by another process
+var errLockLost = apperror.Conflict("the reindex lock was taken over by another process")
+
+// ReindexState is the phase of the most recent reindex
+type ReindexState string
+
+const (
+	ReindexIdle      ReindexState = "idle"
+	ReindexRunning   ReindexState = "running"
+	ReindexSucceeded ReindexState = "succeeded"
+	// ReindexInterrupted and ReindexFailed leave the index and checkpoint in place for the next reindex to resume
+	ReindexInterrupted ReindexState = "interrupted"
+	ReindexFailed      ReindexState = "failed"
+)
+
+// ReindexStatus reports the progress of the most recent reindex
+type ReindexStatus struct {
+	State ReindexState `json:"state"`
+	// Index is the index being built; Previous is the one it replaced
+	Index    string `json:"index,omitempty"`
+	Previous string `json:"previous,omitempty"`
+	// Resumed is set when the reindex continued from a checkpoint
+	Resumed bool `json:"resumed"`
+	// Indexed counts the products copied so far, including those before the checkpoint;
+	// Total is an estimate taken when the reindex started
+	Indexed  int64      `json:"indexed"`
+	Total    int64      `json:"total"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Status returns the progress of the most recent reindex
+func (m *IndexManager) Status() ReindexStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Reindex rebuilds the index and returns its final status. An unfinished earlier reindex
+// is resumed from its checkpoint unless fresh is set.
+func (m *IndexManager) Reindex(ctx context.Context, fresh bool) (ReindexStatus, error) {
+	done, err := m.begin(ctx)
+	if err != nil {
+		return m.Status(), err
+	}
+	err = m.run(ctx, fresh, done)
+	return m.Status(), err
+}
+
+// StartReindex starts Reindex in the background and returns its initial status. ctx only
+// bounds taking the reindex lock.
+func (m *IndexManager) StartReindex(ctx context.Context, fresh bool) (ReindexStatus, error) {
+	done, err := m.begin(ctx)
+	if err != nil {
+		return m.Status(), err
+	}
+	go func() { _ = m.run(m.ctx, fresh, done) }()
+	return m.Status(), nil
+}
+
+// Close stops a running reindex and waits for it to save its checkpoint
+func (m *IndexManager) Close(ctx context.Context) error {
+	m.cancel()
+	m.mu.Lock()
+	done := m.done
+	m.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// begin takes the reindex lock and marks a reindex as running, refusing to start a second
+// one in this process or while another process holds the lock
+func (m *IndexManager) begin(ctx context.Context) (chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.status.State == ReindexRunning {
+		return nil, apperror.Conflict("a reindex is already running")
+	}
+	if m.ctx.Err() != nil {
+		return nil, apperror.Unavailable("the service is shutting down", m.ctx.Err())
+	}
+	if err := m.checkpoints.Lock(ctx, m.index.index, m.owner, reindexLockTTL); err != nil {
+		if errors.Is(err, repository.ErrLocked) {
+			return nil, apperror.Conflict("a reindex is already running in another process")
+		}
+		return nil, err
+	}
+	started := time.Now().UTC()
+	m.status = ReindexStatus{State: ReindexRunning, Started: &started}
+	m.done = make(chan struct{})
+	return m.done, nil
+}
+
+func (m *IndexManager) run(ctx context.Context, fresh bool, done chan struct{}) error {
+	defer close(done)
+
+	start := time.Now()
+	rebuildCtx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.renewLock(rebuildCtx, cancel)
+	}()
+	previous, err := m.rebuild(rebuildCtx, fresh)
+	if cause := context.Cause(rebuildCtx); err != nil && ctx.Err() == nil && cause != nil {
+		err = cause
+	}
+	cancel(nil)
+	<-renewed
+	m.unlock(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	finished := time.Now().UTC()
+	m.status.Finished = &finished
+	m.status.Previous = previous
+	attrs := []any{
+		slog.String(logging.KeyIndex, m.status.Index),
+		slog.Int64("indexed", m.status.Indexed),
+		logging.Duration(time.Since(start)),
+	}
+	switch {
+	case err == nil:
+		m.status.State = ReindexSucceeded
+		slog.Info("reindex finished", append(attrs, slog.String("previous", previous))...)
+	case ctx.Err() != nil:
+		err = ctx.Err()
+		m.status.State = ReindexInterrupted
+		m.status.Error = err.Error()
+		slog.Warn("reindex interrupted; it resumes from its checkpoint when started again", attrs...)
+	default:
+		m.status.State = ReindexFailed
+		m.status.Error = err.Error()
+		slog.Error("reindex failed", append(attrs, logging.Err(err))...)
+	}
+	return err
+}
+
+// renewLock extends the reindex lock until ctx is done. If another process took the lock
+// over, such as after renewals failed until it expired, cancel stops the rebuild.
+func (m *IndexManager) renewLock(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(reindexLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := m.checkpoints.Lock(ctx, m.index.index, m.owner, reindexLockTTL)
+		switch {
+		case errors.Is(err, repository.ErrLocked):
+			cancel(errLockLost)
+			return
+		case err != nil && ctx.Err() == nil:
+			// The lock holds until it expires, so a later renewal can still keep it
+			slog.Warn("failed to renew the reindex lock", logging.Err(err))
+		}
+	}
+}
+
+// unlock releases the reindex lock so another process can resume at once, even when ctx
+// was cancelled; otherwise the lock expires
+func (m *IndexManager) unlock(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+	defer cancel()
+	if err := m.checkpoints.Unlock(ctx, m.index.index, m.owner); err != nil {
+		slog.Warn("failed to release the reindex lock", logging.Err(err))
+	}
+}
+
+// rebuild fills an index from the product store and moves the alias to it, returning the
+// index it replaced
+func (m *IndexManager) rebuild(ctx context.Context, fresh bool) (string, error) {
+	target, afterID, err := m.prepare(ctx, fresh)
+	if err != nil {
+		return "", err
+	}
+	total, err := m.products.Count(ctx)
+	if err != nil {
+		slog.Warn("failed to count products; progress is reported without a total", logging.Err(err))
+	}
+	m.mu.Lock()
+	m.status.Total = total
+	m.mu.Unlock()
+	slog.Info("reindex started",
+		slog.String(logging.KeyIndex, target),
+		slog.String("after_id", afterID),
+		slog.Int64("total", total),
+	)
+
+	if err := m.copyProducts(ctx, target, afterID); err != nil {
+		return "", err
+	}
+	if err := m.refresh(ctx, target); err != nil {
+		return "", err
+	}
+	previous, err := m.swapAlias(ctx, target)
+	if err != nil {
+		return "", err
+	}
+	if err := m.checkpoints.Delete(ctx, m.index.index); err != nil {
+		slog.Warn("failed to delete reindex checkpoint", logging.Err(err))
+	}
+	return previous, nil
+}
+
+// prepare returns the index to fill and the product ID to continue after. The index
+// still carrying the rebuild alias from an unfinished reindex of the current version is
+// reused, continuing after its checkpoint; otherwise it is dropped and a new one created.
+func (m *IndexManager) prepare(ctx context.Context, fresh bool) (string, string, error) {
+	alias := m.index.rebuildAlias()
+	unfinished, err := m.aliasTarget(ctx, alias)
+	if err != nil {
+		return "", "", err
+	}
+
+	if unfinished != "" && !fresh && strings.HasPrefix(unfinished, ProductsIndexPrefix()+"_") {
+		checkpoint, err := m.checkpoints.Load(ctx, m.index.index)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return "", "", err
+		}
+		// Without a matching checkpoint the copy starts over; versioned writes make that safe
+		if checkpoint.Index != unfinished {
+			checkpoint = repository.ReindexCheckpoint{Index: unfinished}
+		}
+		m.mu.Lock()
+		m.status.Index = unfinished
+		m.status.Resumed = true
+		m.status.Indexed = checkpoint.Indexed
+		m.mu.Unlock()
+		return unfinished, checkpoint.AfterID, nil
+	}
+
+	if unfinished != "" {
+		// Deleting the index removes the rebuild alias with it
+		if err := m.deleteIndex(ctx, unfinished); err != nil {
+			return "", "", err
+		}
+		slog.Info("dropped unfinished reindex", slog.String(logging.KeyIndex, unfinished))
+	}
+	target := newProductsIndexName(time.Now())
+	if err := m.createIndex(ctx, target, map[string]interface{}{alias: map[string]interface{}{}}); err != nil {
+		return "", "", err
+	}
+	if err := m.checkpoints.Save(ctx, m.index.index, repository.ReindexCheckpoint{Index: target, Updated: time.Now().UTC()}); err != nil {
+		return "", "", err
+	}
+	m.mu.Lock()
+	m.status.Index = target
+	m.mu.Unlock()
+	return target, "", nil
+}
+
+// batch is a run of products in ID order, numbered in scan order
+type batch struct {
+	seq      int
+	products []models.Product
+}
+
+type batchResult struct {
+	seq    int
+	lastID string
+	count  int
+	err    error
+}
+
+// batchProgress tracks finished batches by sequence number. Batches can finish out of
+// order, so the checkpoint only advances past a batch once every earlier one is indexed.
+type batchProgress struct {
+	completed map[int]batchResult // finished batches after a gap
+	next      int                 // sequence number of the first unfinished batch
+	afterID   string              // last product ID of the contiguous finished batches
+}
+
+func newBatchProgress(afterID string) *batchProgress {
+	return &batchProgress{completed: make(map[int]batchResult), afterID: afterID}
+}
+
+// complete records a finished batch and returns the batches the checkpoint advanced past,
+// in order; it returns none while an earlier batch is still running
+func (p *batchProgress) complete(result batchResult) []batchResult {
+	p.completed[result.seq] = result
+	var advanced []batchResult
+	for done, ok := p.completed[p.next]; ok; done, ok = p.completed[p.next] {
+		delete(p.completed, p.next)
+		p.next++
+		p.afterID = done.lastID
+		advanced = append(advanced, done)
+	}
+	return advanced
+}
+
+// copyProducts scans the products after afterID into target. One goroutine reads batches
+// from the store while cfg.Concurrency workers send them to _bulk. The checkpoint is saved
+// whenever batchProgress advances.
+func (m *IndexManager) copyProducts(ctx context.Context, target, afterID string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan batch, m.cfg.Concurrency)
+	results := make(chan batchResult, m.cfg.Concurrency)
+	scanErr := make(chan error, 1)
+
+	go func() {
+		defer close(batches)
+		seq := 0
+		pending := make([]models.Product, 0, m.cfg.BatchSize)
+		send := func() error {
+			select {
+			case batches <- batch{seq: seq, products: pending}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			seq++
+			pending = make([]models.Product, 0, m.cfg.BatchSize)
+			return nil
+		}
+		err := m.products.Scan(ctx, afterID, func(product models.Product) error {
+			pending = append(pending, product)
+			if len(pending) < m.cfg.BatchSize {
+				return nil
+			}
+			return send()
+		})
+		if err == nil && len(pending) > 0 {
+			err = send()
+		}
+		scanErr <- err
+	}()
+
+	var workers sync.WaitGroup
+	for i := 0; i < m.cfg.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for b := range batches {
+				err := m.index.bulkIndex(ctx, target, b.products)
+				if err == nil && m.afterBatch != nil {
+					m.afterBatch(ctx, b.products)
+				}
+				results <- batchResult{seq: b.seq, lastID: b.products[len(b.products)-1].ProductID, count: len(b.products), err: err}
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	progress := time.NewTicker(m.cfg.ProgressInterval.Duration)
+	defer progress.Stop()
+	start := time.Now()
+	checkpoint := newBatchProgress(afterID)
+	var firstErr error
+	for open := true; open; {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				open = false
+				break
+			}
+			if result.err != nil {
+				if firstErr == nil {
+					firstErr = result.err
+					cancel()
+				}
+				continue
+			}
+			advanced := checkpoint.complete(result)
+			for _, done := range advanced {
+				m.mu.Lock()
+				m.status.Indexed += int64(done.count)
+				m.mu.Unlock()
+			}
+			if len(advanced) > 0 && firstErr == nil {
+				m.saveCheckpoint(ctx, target, checkpoint.afterID)
+			}
+		case <-progress.C:
+			m.logProgress(start)
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return <-scanErr
+}
+
+func (m *IndexManager) saveCheckpoint(ctx context.Context, target, afterID string) {
+	checkpoint := repository.ReindexCheckpoint{Index: target, AfterID: afterID, Indexed: m.Status().Indexed, Updated: time.Now().UTC()}
+	if err := m.checkpoints.Save(ctx, m.index.index, checkpoint); err != nil && ctx.Err() == nil {
+		// The next save covers this one; a resume from an older checkpoint only repeats some batches
+		slog.Warn("failed to save reindex checkpoint", slog.String("after_id", afterID), logging.Err(err))
+	}
+}
+
+func (m *IndexManager) logProgress(start time.Time) {
+	status := m.Status()
+	attrs := []any{
+		slog.String(logging.KeyIndex, status.Index),
+		slog.Int64("indexed", status.Indexed),
+		slog.Int64("total", status.Total),
+		logging.Duration(time.Since(start)),
+	}
+	if status.Total > 0 {
+		attrs = append(attrs, slog.Float64("percent", float64(status.Indexed)*100/float64(status.Total)))
+	}
+	slog.Info("reindex progress", attrs...)
+}
+
+// swapAlias points the alias at target, removes the rebuild alias from it and deletes the
+// index the alias pointed at before, in one atomic request. A legacy index named like the
+// alias is replaced the same way.
+func (m *IndexManager) swapAlias(ctx context.Context, target string) (string, error) {
+	actions := []interface{}{
+		map[string]interface{}{"add": map[string]interface{}{
+			"index": target, "alias": m.index.index, "is_write_index": true,
+		}},
+		map[string]interface{}{"remove": map[string]interface{}{
+			"index": target, "alias": m.index.rebuildAlias(),
+		}},
+	}
+	previous, _, err := m.resolve(ctx)
+	switch {
+	case errors.Is(err, errNoIndex):
+		previous = ""
+	case err != nil:
+		return "", err
+	default:
+		actions = append(actions, map[string]interface{}{"remove_index": map[string]interface{}{"index": previous}})
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"actions": actions})
+	res, err := m.client.Indices.UpdateAliases(bytes.NewReader(body), m.client.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return "", mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", mapResponseError(res)
+	}
+	return previous, nil
+}
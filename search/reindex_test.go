@@ -0,0 +1,37 @@
+package search
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestBatchProgressAdvancesOverContiguousBatches(t *testing.T) {
+	p := newBatchProgress("p0")
+	batch := func(seq int) batchResult {
+		return batchResult{seq: seq, lastID: "p" + strconv.Itoa((seq+1)*10), count: 10}
+	}
+
+	steps := []struct {
+		finished    int
+		wantAdvance []int
+		wantAfterID string
+	}{
+		{finished: 1, wantAfterID: "p0"},
+		{finished: 2, wantAfterID: "p0"},
+		{finished: 0, wantAdvance: []int{0, 1, 2}, wantAfterID: "p30"},
+		{finished: 4, wantAfterID: "p30"},
+		{finished: 3, wantAdvance: []int{3, 4}, wantAfterID: "p50"},
+		{finished: 5, wantAdvance: []int{5}, wantAfterID: "p60"},
+	}
+	for _, step := range steps {
+		var advanced []int
+		for _, done := range p.complete(batch(step.finished)) {
+			advanced = append(advanced, done.seq)
+		}
+		if !slices.Equal(advanced, step.wantAdvance) || p.afterID != step.wantAfterID {
+			t.Errorf("after batch %d: advanced over %v to %q, want %v to %q",
+				step.finished, advanced, p.afterID, step.wantAdvance, step.wantAfterID)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"context"
+	"query-service/models"
+)
+
+// Query describes a full-text product search. An empty Text matches every product, and
+// each filter is only applied when set.
+type Query struct {
+	Text             string
+	CategoryID       string
+	ParentCategoryID string
+	MinPrice         *float64
+	MaxPrice         *float64
+	// InStock keeps only products with inventory left
+	InStock bool
+	// Attributes keeps only products carrying every one of these name/value pairs
+	Attributes []models.Attribute
+	From       int
+	Size       int
+}
+
+// Result is one page of hits, the total number of matches and facets computed over all of them
+type Result struct {
+	Total  int64  `json:"total"`
+	Hits   []Hit  `json:"hits"`
+	Facets Facets `json:"facets"`
+	// DidYouMean is a corrected search text that has matches, offered when the search had none
+	DidYouMean string `json:"didYouMean,omitempty"`
+}
+
+// Hit is a matching product with its relevance score and highlighted snippets of the
+// name and description, keyed by field
+type Hit struct {
+	Product    models.Product      `json:"product"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// Facets count the matches per category, price range and attribute value
+type Facets struct {
+	Categories []Bucket         `json:"categories"`
+	Prices     []PriceBucket    `json:"prices"`
+	Attributes []AttributeFacet `json:"attributes"`
+}
+
+// Bucket counts the matches sharing a value; Label is the display name where it differs from the value
+type Bucket struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// PriceBucket counts the matches priced from From (inclusive) up to To (exclusive); an
+// open end is nil
+type PriceBucket struct {
+	From  *float64 `json:"from,omitempty"`
+	To    *float64 `json:"to,omitempty"`
+	Count int64    `json:"count"`
+}
+
+// AttributeFacet counts the matches per value of one attribute
+type AttributeFacet struct {
+	Name   string   `json:"name"`
+	Values []Bucket `json:"values"`
+}
+
+// priceBreaks are the boundaries of the price facet buckets
+var priceBreaks = []float64{10, 25, 50, 100, 250}
+
+// facetSize caps the number of categories, attribute names and values per attribute returned as facets
+const facetSize = 20
+
+// SuggestQuery asks for products whose name or category name has words starting with the
+// words of Text, as typed into a search box
+type SuggestQuery struct {
+	Text string
+	// Size caps the number of suggestions
+	Size int
+	// PerCategory caps the suggestions from any one category so a single category can't fill the list
+	PerCategory int
+}
+
+// Suggestion is a product matching a SuggestQuery, ranked by Score
+type Suggestion struct {
+	ProductID    string  `json:"productId"`
+	Name         string  `json:"name"`
+	CategoryID   string  `json:"categoryId"`
+	CategoryName string  `json:"categoryName"`
+	Score        float64 `json:"score"`
+}
+
+// SearchIndex maintains the product search index and runs queries against it
+type SearchIndex interface {
+	IndexProduct(ctx context.Context, product models.Product) error
+	Search(ctx context.Context, query Query) (Result, error)
+	Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error)
+}
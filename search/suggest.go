@@ -0,0 +1,201 @@
+package search
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"query-service/models"
+	"slices"
+)
+
+// suggestFields are the edge-ngram subfields suggestions match on, with the product name
+// weighted above the category name
+var suggestFields = []string{"name.suggest^3", "category.name.suggest"}
+
+// Suggest returns the best matching products for a partly typed query. Hits are collapsed
+// on the category so each category contributes at most PerCategory of them.
+func (s *ElasticsearchIndex) Suggest(ctx context.Context, query SuggestQuery) ([]Suggestion, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(suggestBody(query)); err != nil {
+		return nil, fmt.Errorf("failed to encode suggest query: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(s.index),
+		s.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, mapResponseError(res)
+	}
+
+	var response suggestResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse suggest response: %w", err)
+	}
+	return response.suggestions(query), nil
+}
+
+// suggestBody builds the suggest request: every typed word must prefix a word of the name
+// or category name, and the top hits of up to Size categories are returned as inner hits
+func suggestBody(query SuggestQuery) map[string]interface{} {
+	return map[string]interface{}{
+		"query": map[string]interface{}{"multi_match": map[string]interface{}{
+			"query":    query.Text,
+			"type":     "cross_fields",
+			"operator": "and",
+			"fields":   suggestFields,
+		}},
+		"collapse": map[string]interface{}{
+			"field": "category.id",
+			"inner_hits": map[string]interface{}{
+				"name":    "top",
+				"size":    query.PerCategory,
+				"_source": []string{"productId", "name", "category.id", "category.name"},
+			},
+		},
+		"_source": false,
+		"size":    query.Size,
+	}
+}
+
+// suggestResponse is the part of a collapsed search response the service reads
+type suggestResponse struct {
+	Hits struct {
+		Hits []struct {
+			InnerHits struct {
+				Top struct {
+					Hits struct {
+						Hits []struct {
+							Score  float64        `json:"_score"`
+							Source models.Product `json:"_source"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"top"`
+			} `json:"inner_hits"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (r suggestResponse) suggestions(query SuggestQuery) []Suggestion {
+	suggestions := []Suggestion{}
+	for _, group := range r.Hits.Hits {
+		for _, hit := range group.InnerHits.Top.Hits.Hits {
+			suggestions = append(suggestions, newSuggestion(hit.Source, hit.Score))
+		}
+	}
+	return rankSuggestions(suggestions, query)
+}
+
+func newSuggestion(product models.Product, score float64) Suggestion {
+	return Suggestion{
+		ProductID:    product.ProductID,
+		Name:         product.Name,
+		CategoryID:   product.Category.ID,
+		CategoryName: product.Category.Name,
+		Score:        score,
+	}
+}
+
+// rankSuggestions orders suggestions by descending score, then name, keeps at most
+// PerCategory of each category and the first Size overall
+func rankSuggestions(suggestions []Suggestion, query SuggestQuery) []Suggestion {
+	slices.SortStableFunc(suggestions, func(a, b Suggestion) int {
+		if a.Score != b.Score {
+			return cmp.Compare(b.Score, a.Score)
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	perCategory := map[string]int{}
+	ranked := suggestions[:0]
+	for _, suggestion := range suggestions {
+		if len(ranked) == query.Size {
+			break
+		}
+		if perCategory[suggestion.CategoryID] == query.PerCategory {
+			continue
+		}
+		perCategory[suggestion.CategoryID]++
+		ranked = append(ranked, suggestion)
+	}
+	return ranked
+}
+
+// didYouMean asks the phrase suggester for a correction of the search text whose words come
+// from indexed names and descriptions, or returns "" when no correction has matches
+func (s *ElasticsearchIndex) didYouMean(ctx context.Context, query Query) (string, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(didYouMeanBody(query)); err != nil {
+		return "", fmt.Errorf("failed to encode phrase suggestion: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(s.index),
+		s.client.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return "", mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", mapResponseError(res)
+	}
+
+	var response struct {
+		Suggest struct {
+			DidYouMean []struct {
+				Options []struct {
+					Text string `json:"text"`
+				} `json:"options"`
+			} `json:"did_you_mean"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse phrase suggestion: %w", err)
+	}
+	for _, entry := range response.Suggest.DidYouMean {
+		if len(entry.Options) > 0 {
+			return entry.Options[0].Text, nil
+		}
+	}
+	return "", nil
+}
+
+// didYouMeanBody builds a phrase suggestion for the search text. Up to two misspelled words
+// are replaced by indexed words, with typos in any letter, and only corrections that match
+// under the query's filters are kept. The index analyzer is used so synonyms aren't offered
+// as corrections.
+func didYouMeanBody(query Query) map[string]interface{} {
+	generator := func(field string) map[string]interface{} {
+		return map[string]interface{}{"field": field, "suggest_mode": "always", "prefix_length": 0}
+	}
+	collate := map[string]interface{}{"bool": map[string]interface{}{
+		"must": map[string]interface{}{
+			"multi_match": map[string]interface{}{"query": "{{suggestion}}", "fields": searchFields},
+		},
+		"filter": searchFilters(query),
+	}}
+
+	return map[string]interface{}{
+		"suggest": map[string]interface{}{
+			"text": query.Text,
+			"did_you_mean": map[string]interface{}{"phrase": map[string]interface{}{
+				"field":            "name",
+				"analyzer":         "custom_analyzer",
+				"size":             1,
+				"max_errors":       2,
+				"direct_generator": []interface{}{generator("name"), generator("description")},
+				"collate":          map[string]interface{}{"query": map[string]interface{}{"source": collate}},
+			}},
+		},
+		"size": 0,
+	}
+}
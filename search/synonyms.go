@@ -0,0 +1,238 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"query-service/apperror"
+	"strings"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// maxSynonymRules bounds the rules a synonyms file may be replaced with
+const maxSynonymRules = 10000
+
+// synonymsHeader starts every synonyms file written by Replace
+const synonymsHeader = "# Product search synonyms in Solr format, applied at search time.\n" +
+	"# Managed through the admin API; edits by hand need POST /api/admin/search/synonyms/reload.\n"
+
+// SynonymsStatus lists the synonym rules in effect and the indices whose search analyzers
+// were reloaded with them
+type SynonymsStatus struct {
+	Rules    []string `json:"rules"`
+	Reloaded []string `json:"reloaded,omitempty"`
+}
+
+// SynonymSet manages the synonyms file behind the product_synonyms filter. Elasticsearch
+// reads the file from SynonymsPath on each node, so path must be that same file, such as
+// through a shared volume. Changes take effect by reloading the search analyzers of the
+// indices, without recreating them.
+type SynonymSet struct {
+	client *elasticsearch.Client
+	index  *ElasticsearchIndex
+	path   string
+
+	// mu serializes writes and reloads of the file
+	mu sync.Mutex
+}
+
+// NewSynonymSet manages the synonyms file at path for the indices behind index
+func NewSynonymSet(index *ElasticsearchIndex, path string) *SynonymSet {
+	return &SynonymSet{client: index.client, index: index, path: path}
+}
+
+// Rules returns the rules in the file, skipping blank lines and comments. A missing file
+// has no rules.
+func (s *SynonymSet) Rules() ([]string, error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synonyms file: %w", err)
+	}
+
+	rules := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// Replace validates rules, writes them to the file and reloads the search analyzers. If
+// Elasticsearch rejects them, the previous file is restored.
+func (s *SynonymSet) Replace(ctx context.Context, rules []string) (SynonymsStatus, error) {
+	if err := validateSynonymRules(rules); err != nil {
+		return SynonymsStatus{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return SynonymsStatus{}, fmt.Errorf("failed to read synonyms file: %w", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(synonymsHeader)
+	for _, rule := range rules {
+		buf.WriteString(strings.TrimSpace(rule) + "\n")
+	}
+	if err := s.write(buf.Bytes()); err != nil {
+		return SynonymsStatus{}, err
+	}
+
+	reloaded, err := s.reload(ctx)
+	if err != nil {
+		if restoreErr := s.write(previous); restoreErr != nil {
+			return SynonymsStatus{}, errors.Join(err, restoreErr)
+		}
+		// Shards that did reload the rejected rules go back to the previous ones
+		_, _ = s.reload(ctx)
+		return SynonymsStatus{}, err
+	}
+	return s.status(reloaded)
+}
+
+// Reload makes Elasticsearch reread the file, such as after it was edited by hand
+func (s *SynonymSet) Reload(ctx context.Context) (SynonymsStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reloaded, err := s.reload(ctx)
+	if err != nil {
+		return SynonymsStatus{}, err
+	}
+	return s.status(reloaded)
+}
+
+func (s *SynonymSet) status(reloaded []string) (SynonymsStatus, error) {
+	rules, err := s.Rules()
+	if err != nil {
+		return SynonymsStatus{}, err
+	}
+	return SynonymsStatus{Rules: rules, Reloaded: reloaded}, nil
+}
+
+// write replaces the file through a rename so Elasticsearch never reads it half written
+func (s *SynonymSet) write(content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".synonyms-*")
+	if err != nil {
+		return fmt.Errorf("failed to write synonyms file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write synonyms file: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write synonyms file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write synonyms file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write synonyms file: %w", err)
+	}
+	return nil
+}
+
+// reload reloads the search analyzers of the index behind the alias and of an index being
+// rebuilt, returning the indices that were reloaded
+func (s *SynonymSet) reload(ctx context.Context) ([]string, error) {
+	reload := s.client.Indices.ReloadSearchAnalyzers
+	res, err := reload([]string{s.index.index, s.index.rebuildAlias()},
+		reload.WithContext(ctx),
+		reload.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return nil, mapTransportError(err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, mapResponseError(res)
+	}
+
+	var response struct {
+		Shards struct {
+			Failed int `json:"failed"`
+		} `json:"_shards"`
+		ReloadDetails []struct {
+			Index string `json:"index"`
+		} `json:"reload_details"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse reload response: %w", err)
+	}
+	if response.Shards.Failed > 0 {
+		return nil, apperror.Unavailable("search is unavailable",
+			fmt.Errorf("search analyzers failed to reload on %d shards", response.Shards.Failed))
+	}
+	reloaded := make([]string, 0, len(response.ReloadDetails))
+	for _, detail := range response.ReloadDetails {
+		reloaded = append(reloaded, detail.Index)
+	}
+	return reloaded, nil
+}
+
+// validateSynonymRules checks that every rule is a Solr equivalence ("tv, television") or
+// explicit mapping ("tele => television") of non-empty terms
+func validateSynonymRules(rules []string) error {
+	if len(rules) > maxSynonymRules {
+		return apperror.Invalid("the synonym rules are invalid",
+			apperror.InvalidParam{Name: "rules", Reason: fmt.Sprintf("must have at most %d rules", maxSynonymRules)})
+	}
+
+	var invalid []apperror.InvalidParam
+	for i, rule := range rules {
+		if reason := synonymRuleError(rule); reason != "" {
+			invalid = append(invalid, apperror.InvalidParam{Name: fmt.Sprintf("rules[%d]", i), Reason: reason})
+		}
+	}
+	if len(invalid) > 0 {
+		return apperror.Invalid("the synonym rules are invalid", invalid...)
+	}
+	return nil
+}
+
+// synonymRuleError explains why rule is invalid, or returns "" when it is valid
+func synonymRuleError(rule string) string {
+	rule = strings.TrimSpace(rule)
+	switch {
+	case rule == "":
+		return "must not be empty"
+	case strings.ContainsAny(rule, "\r\n"):
+		return "must be a single line"
+	case strings.HasPrefix(rule, "#"):
+		return "must not be a comment"
+	}
+
+	sides := strings.Split(rule, "=>")
+	if len(sides) > 2 {
+		return "must contain at most one =>"
+	}
+	for _, side := range sides {
+		for _, term := range strings.Split(side, ",") {
+			if strings.TrimSpace(term) == "" {
+				return "must not contain empty terms"
+			}
+		}
+	}
+	if len(sides) == 1 && !strings.Contains(rule, ",") {
+		return "must list at least two equivalent terms or map terms with =>"
+	}
+	return ""
+}
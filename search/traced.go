@@ -0,0 +1,45 @@
+package search
+
+import (
+	"context"
+	"query-service/models"
+	"query-service/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TracedIndex records a span around every call to the wrapped search index
+type TracedIndex struct {
+	SearchIndex
+}
+
+func NewTracedIndex(index SearchIndex) *TracedIndex {
+	return &TracedIndex{SearchIndex: index}
+}
+
+func (t *TracedIndex) IndexProduct(ctx context.Context, product models.Product) (err error) {
+	ctx, span := tracing.StartClient(ctx, "elasticsearch", "IndexProduct", attribute.String("product.id", product.ProductID))
+	defer func() { tracing.End(span, err) }()
+	return t.SearchIndex.IndexProduct(ctx, product)
+}
+
+func (t *TracedIndex) Search(ctx context.Context, query Query) (result Result, err error) {
+	ctx, span := tracing.StartClient(ctx, "elasticsearch", "Search",
+		attribute.String("search.text", query.Text),
+		attribute.String("search.category_id", query.CategoryID),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int64("search.total", result.Total))
+		tracing.End(span, err)
+	}()
+	return t.SearchIndex.Search(ctx, query)
+}
+
+func (t *TracedIndex) Suggest(ctx context.Context, query SuggestQuery) (suggestions []Suggestion, err error) {
+	ctx, span := tracing.StartClient(ctx, "elasticsearch", "Suggest", attribute.String("search.text", query.Text))
+	defer func() {
+		span.SetAttributes(attribute.Int("search.suggestions", len(suggestions)))
+		tracing.End(span, err)
+	}()
+	return t.SearchIndex.Suggest(ctx, query)
+}